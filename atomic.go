@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// replaceFile formats the file at path in place and reports whether it
+// changed. If path is a symbolic link, its target is replaced and the link
+// kept. A file that is already formatted is not written at all. If keep
+// is not nil, it is called with path and the SHA-256 sum of the result
+// before the file is replaced, and an error from it leaves the file as it
+// was.
+func replaceFile(path string, opts options, keep func(path string, sum []byte) error) (bool, []diagnostic, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, nil, err
+	}
+	in, err := os.Open(target)
+	if err != nil {
+		return false, nil, err
+	}
+	defer in.Close()
+	orig, err := os.Open(target)
+	if err != nil {
+		return false, nil, err
+	}
+	defer orig.Close()
+
+	var diags []diagnostic
+	changed := false
+	err = writeAtomic(target, func(w io.Writer) (bool, error) {
+		out := &compareWriter{w: w, orig: bufio.NewReader(orig)}
+		sum := sha256.New()
+		var err error
+		if diags, err = formatStream(in, io.MultiWriter(out, sum), opts); err != nil || !out.changed() {
+			return false, err
+		}
+		if keep != nil {
+			if err := keep(path, sum.Sum(nil)); err != nil {
+				return false, err
+			}
+		}
+		changed = true
+		return true, nil
+	})
+	return changed && err == nil, diags, err
+}
+
+// writeAtomic replaces the file at target with what write writes, unless
+// write returns false or an error. The content goes to a temporary file in
+// the same directory, which then replaces the file, so that an interrupted
+// run never leaves it half written. The file keeps its mode and, where
+// allowed, its owner.
+func writeAtomic(target string, write func(io.Writer) (bool, error)) error {
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	out := bufio.NewWriter(tmp)
+	if ok, err := write(out); err != nil || !ok {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	// Changing the owner may clear the setuid and setgid bits, so it
+	// comes first
+	chown(tmp, info)
+	if err := tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// compareWriter writes to w while comparing what is written with orig.
+type compareWriter struct {
+	w      io.Writer
+	orig   *bufio.Reader
+	differ bool
+	buf    []byte
+}
+
+func (c *compareWriter) Write(p []byte) (int, error) {
+	if !c.differ {
+		if cap(c.buf) < len(p) {
+			c.buf = make([]byte, len(p))
+		}
+		n, _ := io.ReadFull(c.orig, c.buf[:len(p)])
+		c.differ = !bytes.Equal(c.buf[:n], p)
+	}
+	return c.w.Write(p)
+}
+
+// changed reports whether what was written differs from orig.
+func (c *compareWriter) changed() bool {
+	if c.differ {
+		return true
+	}
+	_, err := c.orig.Peek(1)
+	return err != io.EOF
+}
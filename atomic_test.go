@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.md")
+	writeFile(t, path, "┌─┐\n│ abc │\n└─┘\n")
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, _, err := replaceFile(path, defaultOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Error("changed = false, want true")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "┌─────┐\n│ abc │\n└─────┘\n"; string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("mode %v, want 0640", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func TestReplaceFileUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.md")
+	writeFile(t, path, "text\n┌─────┐\n│ abc │\n└─────┘\n")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, _, err := replaceFile(path, defaultOptions(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Error("changed = true, want false")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Errorf("modification time %v, want %v", info.ModTime(), old)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary file left behind: %v", entries)
+	}
+}
+
+func TestReplaceFileSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.md")
+	link := filepath.Join(dir, "link.md")
+	writeFile(t, target, "┌─┐\n│ abc │\n└─┘\n")
+	if err := os.Symlink("target.md", link); err != nil {
+		t.Skip(err)
+	}
+
+	if _, _, err := replaceFile(link, defaultOptions(), nil); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("link was replaced by a regular file")
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "┌─────┐") {
+		t.Errorf("target not formatted:\n%s", data)
+	}
+}
+
+func TestCompareWriter(t *testing.T) {
+	tests := []struct {
+		orig, written string
+		want          bool
+	}{
+		{"abc", "abc", false},
+		{"abc", "abd", true},
+		{"abc", "ab", true},
+		{"ab", "abc", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		c := &compareWriter{w: &strings.Builder{}, orig: bufio.NewReader(strings.NewReader(tt.orig))}
+		for _, b := range []byte(tt.written) {
+			c.Write([]byte{b})
+		}
+		if got := c.changed(); got != tt.want {
+			t.Errorf("orig %q, written %q: changed = %v, want %v", tt.orig, tt.written, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+// defaultBackupSuffix is appended to backups when -backup has no value.
+const defaultBackupSuffix = ".orig"
+
+// backupFlag is the -backup flag, the suffix of the backup file saved next
+// to each file before it is overwritten. Given without a value, it uses
+// defaultBackupSuffix.
+type backupFlag struct {
+	suffix string
+}
+
+func (b *backupFlag) String() string {
+	if b == nil {
+		return ""
+	}
+	return b.suffix
+}
+
+func (b *backupFlag) Set(s string) error {
+	switch s {
+	case "true":
+		s = defaultBackupSuffix
+	case "false":
+		s = ""
+	case "":
+		return errors.New("empty backup suffix")
+	}
+	if strings.ContainsAny(s, `/\`) {
+		return errors.New("backup suffix cannot contain a path separator")
+	}
+	b.suffix = s
+	return nil
+}
+
+func (b *backupFlag) IsBoolFlag() bool { return true }
+
+// copyFile copies the file at src to dst with the same permissions,
+// replacing dst if it exists.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// keepOriginal returns a function for replaceFile that saves the original
+// of each file it replaces next to it with suffix, unless suffix is empty,
+// and in j, unless it is nil. Only a failure to save the backup stops the
+// file from being replaced.
+func keepOriginal(suffix string, j *journal) func(path string, sum []byte) error {
+	return func(path string, sum []byte) error {
+		if suffix != "" {
+			if err := copyFile(path, path+suffix); err != nil {
+				return err
+			}
+		}
+		if j != nil {
+			j.record(path, sum)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupFlag(t *testing.T) {
+	tests := []struct {
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{nil, "", false},
+		{[]string{"-backup"}, ".orig", false},
+		{[]string{"-backup=.bak"}, ".bak", false},
+		{[]string{"-backup=false"}, "", false},
+		{[]string{"-backup="}, "", true},
+		{[]string{"-backup=/x"}, "", true},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		var b backupFlag
+		fs.Var(&b, "backup", "")
+		err := fs.Parse(tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%v: error %v, wantErr %v", tt.args, err, tt.wantErr)
+			continue
+		}
+		if err == nil && b.suffix != tt.want {
+			t.Errorf("%v: suffix %q, want %q", tt.args, b.suffix, tt.want)
+		}
+	}
+}
+
+func TestReplaceFileBackup(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.md")
+	original := "┌─┐\n│ abc │\n└─┘\n"
+	writeFile(t, path, original)
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := replaceFile(path, defaultOptions(), keepOriginal(".bak", nil)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != original {
+		t.Errorf("backup:\n%s\nwant:\n%s", data, original)
+	}
+	info, err := os.Stat(path + ".bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("backup mode %v, want 0640", info.Mode().Perm())
+	}
+
+	// Formatted files are not backed up again
+	if err := os.Remove(path + ".bak"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := replaceFile(path, defaultOptions(), keepOriginal(".bak", nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak"); !os.IsNotExist(err) {
+		t.Errorf("unchanged file was backed up: %v", err)
+	}
+}
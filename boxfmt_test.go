@@ -30,7 +30,7 @@ func TestGoldenFiles(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			result := processFile(string(inputData))
+			result, _ := processFile(string(inputData), defaultOptions())
 
 			if *update {
 				if err := os.WriteFile(expectedPath, []byte(result), 0644); err != nil {
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// joint records whether a column boundary on a border line continues
+// above it (┴), below it (┬), or both (┼).
+type joint struct {
+	up   bool
+	down bool
+}
+
+// columnLayout is the column structure of a box: the position of every
+// column boundary used by any of its sections, and for each border line
+// which of those boundaries it joins. Content lines have nil joints.
+type columnLayout struct {
+	separators []int
+	joints     [][]joint
+}
+
+// detectColumns infers the column layout of a box from all of its border
+// lines and content separators. Border lines with as many junctions as the
+// busiest border are matched to it in order, so borders drawn at different
+// widths still agree; junctions on other borders are matched by position.
+// A section whose rows all have the same number of separators contributes
+// boundaries that its borders fail to draw.
+func detectColumns(region boxRegion) columnLayout {
+	n := len(region.lines)
+	positions := make([][]int, n)
+	kinds := make([][]rune, n)
+	ref := -1
+	for i, cl := range region.lines {
+		if cl.typ == lineContent {
+			continue
+		}
+		positions[i], kinds[i] = borderJunctions(cl)
+		if ref < 0 || len(positions[i]) > len(positions[ref]) {
+			ref = i
+		}
+	}
+	if ref < 0 {
+		return columnLayout{}
+	}
+
+	var separators []int
+	separators = append(separators, positions[ref]...)
+	joints := make([]map[int]joint, n)
+	for i, cl := range region.lines {
+		if cl.typ == lineContent {
+			continue
+		}
+		joints[i] = map[int]joint{}
+		for j, p := range positions[i] {
+			k := j
+			if len(positions[i]) != len(positions[ref]) {
+				k = separatorIndex(&separators, p)
+			}
+			joints[i][k] = kindJoint(kinds[i][j])
+		}
+	}
+
+	upper := 0
+	var rows []int
+	for i, cl := range region.lines {
+		if cl.typ == lineContent {
+			rows = append(rows, i)
+			continue
+		}
+		if i > 0 {
+			addContentSeparators(region, rows, joints[upper], joints[i], &separators)
+		}
+		rows = nil
+		upper = i
+	}
+
+	if len(separators) == 0 {
+		return columnLayout{}
+	}
+
+	// Number boundaries from left to right
+	order := make([]int, len(separators))
+	for k := range order {
+		order[k] = k
+	}
+	sort.Slice(order, func(a, b int) bool { return separators[order[a]] < separators[order[b]] })
+	remap := make([]int, len(order))
+	for newK, oldK := range order {
+		remap[oldK] = newK
+	}
+
+	layout := columnLayout{
+		separators: make([]int, len(separators)),
+		joints:     make([][]joint, n),
+	}
+	for oldK, p := range separators {
+		layout.separators[remap[oldK]] = p
+	}
+	for i, m := range joints {
+		if m == nil {
+			continue
+		}
+		layout.joints[i] = make([]joint, len(separators))
+		for oldK, j := range m {
+			layout.joints[i][remap[oldK]] = j
+		}
+	}
+
+	return layout
+}
+
+// borderJunctions returns the positions and runes of the inner junctions
+// of a border line.
+func borderJunctions(cl classifiedLine) ([]int, []rune) {
+	var positions []int
+	var kinds []rune
+	runes := []rune(cl.trimmed)
+	for i, r := range runes {
+		if i == 0 || i == len(runes)-1 || !isJunction(r) {
+			continue
+		}
+		positions = append(positions, i)
+		kinds = append(kinds, r)
+	}
+	return positions, kinds
+}
+
+// kindJoint reports which ways a junction rune runs. ASCII '+' junctions
+// are taken to run both ways.
+func kindJoint(r rune) joint {
+	switch r {
+	case '┬':
+		return joint{down: true}
+	case '┴':
+		return joint{up: true}
+	}
+	return joint{up: true, down: true}
+}
+
+func separatorIndex(separators *[]int, pos int) int {
+	if k := slices.Index(*separators, pos); k >= 0 {
+		return k
+	}
+	*separators = append(*separators, pos)
+	return len(*separators) - 1
+}
+
+// addContentSeparators adds the boundaries of a section whose rows agree on
+// more separators than its upper and lower borders draw. The rows need to
+// have the same number of separators but not at the same positions, since
+// hand-drawn rows are often misaligned. The drawn boundaries take the
+// separators nearest to them, in order, and each of the others is placed at
+// its rightmost position.
+func addContentSeparators(region boxRegion, rows []int, upper, lower map[int]joint, separators *[]int) {
+	if len(rows) < 2 {
+		return
+	}
+
+	positions := make([][]int, len(rows))
+	for r, row := range rows {
+		positions[r] = contentSeparatorPositions(region.lines[row])
+		if len(positions[r]) != len(positions[0]) {
+			return
+		}
+	}
+
+	var drawn []int
+	for k := range *separators {
+		if upper[k].down || lower[k].up {
+			drawn = append(drawn, k)
+		}
+	}
+	n := len(positions[0])
+	if n <= len(drawn) {
+		return
+	}
+	sort.Slice(drawn, func(a, b int) bool { return (*separators)[drawn[a]] < (*separators)[drawn[b]] })
+
+	boundaries := make([]int, n)
+	for c := range boundaries {
+		boundaries[c] = -1
+	}
+	next := 0
+	for d, k := range drawn {
+		// Leave a separator for each drawn boundary to the right
+		best := next
+		for c := next + 1; c <= n-len(drawn)+d; c++ {
+			if separatorDistance(positions, c, (*separators)[k]) < separatorDistance(positions, best, (*separators)[k]) {
+				best = c
+			}
+		}
+		boundaries[best] = k
+		next = best + 1
+	}
+
+	for c, k := range boundaries {
+		if k < 0 {
+			p := 0
+			for _, ps := range positions {
+				p = max(p, ps[c])
+			}
+			k = separatorIndex(separators, p)
+		}
+		j := upper[k]
+		j.down = true
+		upper[k] = j
+		j = lower[k]
+		j.up = true
+		lower[k] = j
+	}
+}
+
+// separatorDistance is how far the nearest of the rows' separators c lies
+// from pos.
+func separatorDistance(positions [][]int, c, pos int) int {
+	d := math.MaxInt
+	for _, ps := range positions {
+		d = min(d, max(ps[c]-pos, pos-ps[c]))
+	}
+	return d
+}
+
+// contentSeparatorPositions returns the display columns of the inner
+// separators of a content line, measured from its left edge.
+func contentSeparatorPositions(cl classifiedLine) []int {
+	var positions []int
+	runes := []rune(cl.trimmed)
+	seps := cellSeparators(runes)
+	col := 0
+	for i, r := range runes {
+		if len(seps) > 0 && seps[0] == i {
+			positions = append(positions, col)
+			seps = seps[1:]
+		}
+		col += runewidth.RuneWidth(r)
+	}
+	return positions
+}
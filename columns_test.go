@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectColumns(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		want  []int
+	}{
+		{"single column", []string{"┌────┐", "│ a  │", "└────┘"}, nil},
+		{"top border", []string{"┌──┬──┐", "│ a│ b│", "└──┴──┘"}, []int{3}},
+		{"divider only", []string{"┌─────┐", "│ a   │", "├──┬──┤", "│ b│ c│", "└──┴──┘"}, []int{3}},
+		{"borders of different widths", []string{"┌──┬──┐", "│ a│ b│", "└────┴────┘"}, []int{3}},
+		{"changing sections", []string{"┌────┬────┐", "│ a  │ b  │", "├──┬─┴─┬──┤", "│ c│ d │ e│", "└──┴───┴──┘"}, []int{3, 5, 7}},
+		{"aligned content", []string{"┌───────┐", "│ a │ b │", "│ c │ d │", "└───────┘"}, []int{4}},
+		{"unaligned content", []string{"┌───────┐", "│ a │ b │", "│ cc │ d │", "└───────┘"}, []int{5}},
+		{"different separator counts", []string{"┌───────┐", "│ a │ b │", "│ c │ d │ e │", "└───────┘"}, nil},
+		{"fewer drawn junctions", []string{"┌───┬───┐", "│ aaaaa │ b │ c │", "│ x │ y │ z │", "└───┴───┘"}, []int{4, 12}},
+		{"drawn junction in order", []string{"┌───────┬───┐", "│ a │ b │ c │", "│ d │ e │ f │", "└───────┴───┘"}, []int{4, 8}},
+	}
+	for _, tt := range tests {
+		region := boxRegion{lines: classifyLines(tt.lines)}
+		got := detectColumns(region).separators
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: separators = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: separators = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestFixColumnsFromDivider(t *testing.T) {
+	input := strings.Join([]string{
+		"┌────┐",
+		"│ Title │",
+		"├──┬──┤",
+		"│ a│ bb│",
+		"│ ccc│ d│",
+		"└──┴──┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"┌──────────┐",
+		"│ Title    │",
+		"├─────┬────┤",
+		"│ a   │ bb │",
+		"│ ccc │ d  │",
+		"└─────┴────┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixUnalignedContentColumns(t *testing.T) {
+	input := strings.Join([]string{"┌────────┐", "│ a │ b │", "│ cc │ d │", "└────────┘"}, "\n")
+	want := strings.Join([]string{"┌────┬───┐", "│ a  │ b │", "│ cc │ d │", "└────┴───┘"}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixContentColumnsWithFewerJunctions(t *testing.T) {
+	input := strings.Join([]string{"┌───┬───┐", "│ aaaaa │ b │ c │", "│ x │ y │ z │", "└───┴───┘"}, "\n")
+	want := strings.Join([]string{"┌───────┬───┬───┐", "│ aaaaa │ b │ c │", "│ x     │ y │ z │", "└───────┴───┴───┘"}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixChangingColumnCount(t *testing.T) {
+	input := strings.Join([]string{
+		"┌────┬────┐",
+		"│ a  │ b  │",
+		"├──┬─┴─┬──┤",
+		"│ c│ d │ e│",
+		"└──┴───┴──┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"┌──────┬──────┐",
+		"│ a    │ b    │",
+		"├───┬──┴──┬───┤",
+		"│ c │ d   │ e │",
+		"└───┴─────┴───┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// configNames are the file names looked up in each directory, in order of
+// precedence.
+var configNames = []string{".boxfmt.toml", ".boxfmt.yaml", ".boxfmt.yml"}
+
+// configSettings are the options a config file can set. Nil fields are
+// left as they are.
+type configSettings struct {
+	Style          *string `toml:"style" yaml:"style"`
+	Align          *string `toml:"align" yaml:"align"`
+	TabWidth       *int    `toml:"tab_width" yaml:"tab_width"`
+	AmbiguousWidth *int    `toml:"ambiguous_width" yaml:"ambiguous_width"`
+	PadLeft        *int    `toml:"pad_left" yaml:"pad_left"`
+	PadRight       *int    `toml:"pad_right" yaml:"pad_right"`
+	MinColumnWidth *int    `toml:"min_column_width" yaml:"min_column_width"`
+	MaxWidth       *int    `toml:"max_width" yaml:"max_width"`
+	Repair         *bool   `toml:"repair" yaml:"repair"`
+	PadCells       *bool   `toml:"pad_cells" yaml:"pad_cells"`
+	ToTable        *bool   `toml:"to_table" yaml:"to_table"`
+	FromTable      *bool   `toml:"from_table" yaml:"from_table"`
+	PreserveIndent *bool   `toml:"preserve_indent" yaml:"preserve_indent"`
+	Uniform        *bool   `toml:"uniform" yaml:"uniform"`
+	Encoding       *string `toml:"encoding" yaml:"encoding"`
+}
+
+// configOverride applies its settings to the files matching any of its
+// globs.
+type configOverride struct {
+	Files          []string `toml:"files" yaml:"files"`
+	configSettings `yaml:",inline"`
+
+	patterns []*regexp.Regexp
+}
+
+// config is a .boxfmt.toml or .boxfmt.yaml file. Globs are relative to the
+// directory holding the file.
+type config struct {
+	configSettings `yaml:",inline"`
+	Include        []string         `toml:"include" yaml:"include"`
+	Exclude        []string         `toml:"exclude" yaml:"exclude"`
+	Overrides      []configOverride `toml:"overrides" yaml:"overrides"`
+
+	path    string
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{path: path}
+	if filepath.Ext(path) == ".toml" {
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("%s: unknown key %q", path, undecoded[0].String())
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if cfg.include, err = compileGlobs(cfg.Include); err != nil {
+		return nil, fmt.Errorf("%s: include: %w", path, err)
+	}
+	if cfg.exclude, err = compileGlobs(cfg.Exclude); err != nil {
+		return nil, fmt.Errorf("%s: exclude: %w", path, err)
+	}
+	for i := range cfg.Overrides {
+		o := &cfg.Overrides[i]
+		if o.patterns, err = compileGlobs(o.Files); err != nil {
+			return nil, fmt.Errorf("%s: overrides: %w", path, err)
+		}
+	}
+
+	// Catch invalid values now rather than on the first matching file
+	for _, s := range append([]configSettings{cfg.configSettings}, overrideSettings(cfg.Overrides)...) {
+		if _, err := s.apply(defaultOptions()); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return cfg, nil
+}
+
+func overrideSettings(overrides []configOverride) []configSettings {
+	settings := make([]configSettings, len(overrides))
+	for i, o := range overrides {
+		settings[i] = o.configSettings
+	}
+	return settings
+}
+
+func compileGlobs(globs []string) ([]*regexp.Regexp, error) {
+	patterns := make([]*regexp.Regexp, len(globs))
+	for i, glob := range globs {
+		re, err := compileGlob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		patterns[i] = re
+	}
+	return patterns, nil
+}
+
+func matchAny(patterns []*regexp.Regexp, rel string) bool {
+	for _, re := range patterns {
+		if re.MatchString(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// rel returns path relative to the config file's directory, with forward
+// slashes.
+func (c *config) rel(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	rel, err := filepath.Rel(filepath.Dir(c.path), abs)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// includes reports whether path is selected by the include and exclude
+// globs. With no include globs, every file not excluded is selected.
+func (c *config) includes(path string) bool {
+	rel := c.rel(path)
+	if len(c.include) > 0 && !matchAny(c.include, rel) {
+		return false
+	}
+	return !matchAny(c.exclude, rel)
+}
+
+// excludes reports whether path is removed by the exclude globs.
+func (c *config) excludes(path string) bool {
+	return matchAny(c.exclude, c.rel(path))
+}
+
+// options returns opts with the config's settings for path applied: the
+// top-level settings first, then each matching override in order.
+func (c *config) options(path string, opts options) (options, error) {
+	opts, err := c.configSettings.apply(opts)
+	if err != nil {
+		return opts, err
+	}
+	rel := c.rel(path)
+	for _, o := range c.Overrides {
+		if !matchAny(o.patterns, rel) {
+			continue
+		}
+		if opts, err = o.configSettings.apply(opts); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func (s configSettings) apply(opts options) (options, error) {
+	if s.Style != nil {
+		style, err := parseStyle(*s.Style)
+		if err != nil {
+			return opts, fmt.Errorf("style: %w", err)
+		}
+		opts.style = style
+	}
+	if s.Align != nil {
+		aligns, err := parseAlignments(*s.Align)
+		if err != nil {
+			return opts, fmt.Errorf("align: %w", err)
+		}
+		opts.align = aligns
+	}
+	if s.TabWidth != nil {
+		if *s.TabWidth < 1 {
+			return opts, fmt.Errorf("tab_width: must be at least 1, got %d", *s.TabWidth)
+		}
+		opts.tabWidth = *s.TabWidth
+	}
+	if s.AmbiguousWidth != nil {
+		if *s.AmbiguousWidth != 1 && *s.AmbiguousWidth != 2 {
+			return opts, fmt.Errorf("ambiguous_width: must be 1 or 2, got %d", *s.AmbiguousWidth)
+		}
+		opts.ambiguousWidth = *s.AmbiguousWidth
+	}
+	if s.PadLeft != nil {
+		if *s.PadLeft < 0 {
+			return opts, fmt.Errorf("pad_left: must not be negative, got %d", *s.PadLeft)
+		}
+		opts.padLeft = *s.PadLeft
+	}
+	if s.PadRight != nil {
+		if *s.PadRight < 0 {
+			return opts, fmt.Errorf("pad_right: must not be negative, got %d", *s.PadRight)
+		}
+		opts.padRight = *s.PadRight
+	}
+	if s.MinColumnWidth != nil {
+		if *s.MinColumnWidth < 0 {
+			return opts, fmt.Errorf("min_column_width: must not be negative, got %d", *s.MinColumnWidth)
+		}
+		opts.minColumnWidth = *s.MinColumnWidth
+	}
+	if s.MaxWidth != nil {
+		if *s.MaxWidth < 0 {
+			return opts, fmt.Errorf("max_width: must not be negative, got %d", *s.MaxWidth)
+		}
+		opts.maxWidth = *s.MaxWidth
+	}
+	if s.Repair != nil {
+		opts.repair = *s.Repair
+	}
+	if s.PadCells != nil {
+		opts.padCells = *s.PadCells
+	}
+	if s.ToTable != nil {
+		opts.toTable = *s.ToTable
+	}
+	if s.FromTable != nil {
+		opts.fromTable = *s.FromTable
+	}
+	if s.PreserveIndent != nil {
+		opts.preserveIndent = *s.PreserveIndent
+	}
+	if s.Uniform != nil {
+		opts.uniform = *s.Uniform
+	}
+	if s.Encoding != nil {
+		encoding, err := parseEncoding(*s.Encoding)
+		if err != nil {
+			return opts, fmt.Errorf("encoding: %w", err)
+		}
+		opts.encoding = encoding
+	}
+	return opts, nil
+}
+
+// configFinder finds the config file for each input file by walking up
+// from its directory, caching the result for every directory visited.
+type configFinder struct {
+	cache map[string]*config
+}
+
+func newConfigFinder() *configFinder {
+	return &configFinder{cache: make(map[string]*config)}
+}
+
+// find returns the nearest config for the file at path, or nil if no
+// directory above it has one.
+func (f *configFinder) find(path string) (*config, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var visited []string
+	var cfg *config
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if cached, ok := f.cache[dir]; ok {
+			cfg = cached
+			break
+		}
+		visited = append(visited, dir)
+		if cfg, err = configIn(dir); err != nil {
+			return nil, err
+		}
+		if cfg != nil || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	for _, dir := range visited {
+		f.cache[dir] = cfg
+	}
+	return cfg, nil
+}
+
+// configIn loads the config file in dir, or returns nil if it has none.
+func configIn(dir string) (*config, error) {
+	for _, name := range configNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		return loadConfig(path)
+	}
+	return nil, nil
+}
+
+// optionResolver resolves the options for each file: the defaults, then
+// .editorconfig, then the boxfmt config, then the command-line flags.
+type optionResolver struct {
+	// fixed is the config given with -config, used instead of looking one
+	// up for each file.
+	fixed *config
+
+	// include is set when -include selects the files, so that the
+	// config's include globs do not.
+	include bool
+
+	configs       *configFinder
+	editorConfigs *editorConfigFinder
+	flags         func(options) options
+}
+
+func newOptionResolver(flags func(options) options) *optionResolver {
+	return &optionResolver{
+		configs:       newConfigFinder(),
+		editorConfigs: newEditorConfigFinder(),
+		flags:         flags,
+	}
+}
+
+// config returns the config for the file at path, or nil if it has none.
+func (r *optionResolver) config(path string) (*config, error) {
+	if r.fixed != nil {
+		return r.fixed, nil
+	}
+	return r.configs.find(path)
+}
+
+// resolve returns the options for the file at path, and false if the
+// config excludes it. With -include, only the config's exclude globs
+// apply.
+func (r *optionResolver) resolve(path string) (options, bool, error) {
+	cfg, err := r.config(path)
+	if err != nil {
+		return options{}, false, err
+	}
+	included := cfg == nil || !cfg.excludes(path) && (r.include || cfg.includes(path))
+
+	props, err := r.editorConfigs.properties(path)
+	if err != nil {
+		return options{}, false, err
+	}
+	opts := applyEditorConfig(defaultOptions(), props)
+	if cfg != nil {
+		if opts, err = cfg.options(path, opts); err != nil {
+			return options{}, false, fmt.Errorf("%s: %w", cfg.path, err)
+		}
+	}
+	if r.flags != nil {
+		opts = r.flags(opts)
+	}
+	return opts, included, nil
+}
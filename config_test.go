@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigOptions(t *testing.T) {
+	configs := map[string]string{
+		".boxfmt.toml": `
+style = "ascii"
+tab_width = 8
+pad_left = 2
+uniform = true
+min_column_width = 3
+exclude = ["vendor"]
+
+[[overrides]]
+files = ["docs/**/*.md"]
+style = "unicode"
+align = "l,r"
+`,
+		".boxfmt.yaml": `
+style: ascii
+tab_width: 8
+pad_left: 2
+uniform: true
+min_column_width: 3
+exclude: [vendor]
+overrides:
+  - files: ["docs/**/*.md"]
+    style: unicode
+    align: l,r
+`,
+	}
+
+	for name, content := range configs {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile(t, filepath.Join(dir, name), content)
+			cfg, err := loadConfig(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			opts, err := cfg.options(filepath.Join(dir, "README.md"), defaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.style != styleASCII || opts.tabWidth != 8 || opts.align != nil || opts.padLeft != 2 || opts.padRight != 1 || opts.minColumnWidth != 3 || !opts.uniform {
+				t.Errorf("top-level options = %+v", opts)
+			}
+
+			opts, err = cfg.options(filepath.Join(dir, "docs", "guide", "intro.md"), defaultOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.style != styleUnicode || opts.tabWidth != 8 || !slices.Equal(opts.align, []alignment{alignLeft, alignRight}) {
+				t.Errorf("override options = %+v", opts)
+			}
+
+			if !cfg.includes(filepath.Join(dir, "README.md")) {
+				t.Error("README.md excluded")
+			}
+			if cfg.includes(filepath.Join(dir, "vendor", "lib", "README.md")) {
+				t.Error("vendor/lib/README.md included")
+			}
+		})
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{".boxfmt.toml", `styel = "ascii"`, "unknown key"},
+		{".boxfmt.yaml", "styel: ascii\n", "not found"},
+		{".boxfmt.toml", `style = "double"`, "unknown style"},
+		{".boxfmt.toml", "[[overrides]]\nfiles = [\"*.md\"]\ntab_width = 0\n", "tab_width"},
+		{".boxfmt.yaml", "ambiguous_width: 3\n", "ambiguous_width"},
+		{".boxfmt.toml", "pad_right = -1\n", "pad_right"},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.name)
+		writeFile(t, path, tt.content)
+		_, err := loadConfig(path)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("loadConfig(%q) error = %v, want containing %q", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestConfigFinder(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".boxfmt.toml"), `style = "ascii"`)
+	writeFile(t, filepath.Join(dir, "docs", ".boxfmt.yaml"), "tab_width: 2\n")
+
+	finder := newConfigFinder()
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(dir, "README.md"), filepath.Join(dir, ".boxfmt.toml")},
+		{filepath.Join(dir, "src", "a", "notes.md"), filepath.Join(dir, ".boxfmt.toml")},
+		{filepath.Join(dir, "docs", "intro.md"), filepath.Join(dir, "docs", ".boxfmt.yaml")},
+		{filepath.Join(dir, "docs", "guide", "intro.md"), filepath.Join(dir, "docs", ".boxfmt.yaml")},
+	}
+
+	for _, tt := range tests {
+		cfg, err := finder.find(tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg == nil || cfg.path != tt.want {
+			t.Errorf("find(%q) = %v, want %s", tt.path, cfg, tt.want)
+		}
+	}
+}
+
+func TestOptionResolver(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".editorconfig"), "root = true\n[*]\nindent_style = tab\ntab_width = 8\nmax_line_length = 80\n")
+	writeFile(t, filepath.Join(dir, ".boxfmt.toml"), "tab_width = 2\nexclude = [\"gen\"]\n")
+
+	resolver := newOptionResolver(func(opts options) options {
+		opts.maxWidth = 100
+		return opts
+	})
+
+	opts, ok, err := resolver.resolve(filepath.Join(dir, "README.md"))
+	if err != nil || !ok {
+		t.Fatalf("resolve = %v, %v", ok, err)
+	}
+	if !opts.indentTabs || opts.tabWidth != 2 || opts.maxWidth != 100 {
+		t.Errorf("options = %+v, want tabs, tab width 2 and max width 100", opts)
+	}
+
+	// An excluded file still has options, to be passed through with
+	opts, ok, err = resolver.resolve(filepath.Join(dir, "gen", "api.md"))
+	if err != nil || ok {
+		t.Errorf("excluded file: resolve = %v, %v", ok, err)
+	}
+	if opts.tabWidth != 2 {
+		t.Errorf("excluded file: options = %+v, want tab width 2", opts)
+	}
+}
+
+func TestOptionResolverInclude(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".boxfmt.toml"), "include = [\"*.md\"]\nexclude = [\"gen\"]\n")
+	resolver := newOptionResolver(nil)
+
+	if _, ok, _ := resolver.resolve(filepath.Join(dir, "a.markdown")); ok {
+		t.Error("file outside the include globs resolved")
+	}
+
+	// -include takes the place of the config's include globs
+	resolver.include = true
+	if _, ok, err := resolver.resolve(filepath.Join(dir, "a.markdown")); err != nil || !ok {
+		t.Errorf("with -include, resolve = %v, %v", ok, err)
+	}
+	if _, ok, _ := resolver.resolve(filepath.Join(dir, "gen", "a.markdown")); ok {
+		t.Error("with -include, excluded file resolved")
+	}
+}
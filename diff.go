@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// lineRange is a half-open range of 0-based line indexes.
+type lineRange struct {
+	start int
+	end   int
+}
+
+// overlapsAny reports whether the lines from start up to end intersect any
+// of ranges.
+func overlapsAny(ranges []lineRange, start, end int) bool {
+	for _, r := range ranges {
+		if r.start < end && start < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// addLine adds line to ranges, extending the last range when it is
+// adjacent.
+func addLine(ranges []lineRange, line int) []lineRange {
+	if line < 0 {
+		return ranges
+	}
+	if n := len(ranges); n > 0 && ranges[n-1].end >= line {
+		ranges[n-1].end = max(ranges[n-1].end, line+1)
+		return ranges
+	}
+	return append(ranges, lineRange{start: line, end: line + 1})
+}
+
+// addDeletion adds the lines on either side of a deletion before line.
+func addDeletion(ranges []lineRange, line int) []lineRange {
+	return addLine(addLine(ranges, line-1), line)
+}
+
+// parseUnifiedDiff returns the changed lines of each file in a unified
+// diff, keyed by the file's new path joined to dir. Added lines count as
+// changed, and so do the two lines around a deletion that no added lines
+// replace. Files deleted by the diff are left out.
+func parseUnifiedDiff(r io.Reader, dir string) (map[string][]lineRange, error) {
+	changes := make(map[string][]lineRange)
+	var file string
+	var h hunk
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if h.oldLeft == 0 && h.newLeft == 0 {
+			switch {
+			case strings.HasPrefix(text, "+++ "):
+				name, err := diffPath(text[len("+++ "):])
+				if err != nil {
+					return nil, err
+				}
+				file = ""
+				if name != "/dev/null" {
+					file = filepath.Join(dir, filepath.FromSlash(name))
+				}
+			case strings.HasPrefix(text, "@@ "):
+				var err error
+				if h, err = parseHunkHeader(text); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+"):
+			// Lines replacing deleted ones cover the deletion
+			h.deleted = false
+			if file != "" {
+				changes[file] = addLine(changes[file], h.line)
+			}
+			h.line++
+			h.newLeft--
+		case strings.HasPrefix(text, "-"):
+			h.deleted = true
+			h.oldLeft--
+		case strings.HasPrefix(text, `\`):
+			// "\ No newline at end of file"
+			continue
+		default:
+			if h.deleted && file != "" {
+				changes[file] = addDeletion(changes[file], h.line)
+			}
+			h.deleted = false
+			h.line++
+			h.oldLeft--
+			h.newLeft--
+		}
+		if h.deleted && h.oldLeft == 0 && h.newLeft == 0 && file != "" {
+			changes[file] = addDeletion(changes[file], h.line)
+		}
+	}
+	return changes, scanner.Err()
+}
+
+// hunk tracks the position within a hunk: the 0-based index of the next
+// new-file line, the number of old and new lines still to come, and
+// whether lines were just deleted without being replaced yet.
+type hunk struct {
+	line    int
+	oldLeft int
+	newLeft int
+	deleted bool
+}
+
+// parseHunkHeader parses a hunk header such as "@@ -12,3 +14,5 @@".
+func parseHunkHeader(header string) (hunk, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return hunk{}, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	_, oldCount, err := parseHunkRange(fields[1][1:])
+	if err != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header: %s", header)
+	}
+	newStart, newCount, err := parseHunkRange(fields[2][1:])
+	if err != nil {
+		return hunk{}, fmt.Errorf("invalid hunk header: %s", header)
+	}
+
+	h := hunk{line: newStart - 1, oldLeft: oldCount, newLeft: newCount}
+	if newCount == 0 {
+		// A hunk adding no lines gives the line before the change
+		h.line = newStart
+	}
+	return h, nil
+}
+
+// parseHunkRange parses "start,count" or "start", where count is 1.
+func parseHunkRange(s string) (int, int, error) {
+	start, count, ok := strings.Cut(s, ",")
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return n, 1, nil
+	}
+	c, err := strconv.Atoi(count)
+	return n, c, err
+}
+
+// diffPath extracts the path from the rest of a "+++ " line, removing the
+// "b/" prefix git adds, a trailing timestamp, and quoting.
+func diffPath(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) {
+		end := strings.LastIndex(s, `"`)
+		unquoted, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid path in diff: %s", s)
+		}
+		s = unquoted
+	} else if name, _, ok := strings.Cut(s, "\t"); ok {
+		s = name
+	}
+	if s == "/dev/null" {
+		return s, nil
+	}
+	return strings.TrimPrefix(s, "b/"), nil
+}
+
+// gitDiff returns the lines changed in the working tree since base, by
+// running git diff in the current directory.
+func gitDiff(base string) (map[string][]lineRange, error) {
+	top, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git rev-parse: %w", gitError(err))
+	}
+
+	out, err := exec.Command("git", "diff", "--no-color", "--no-ext-diff", "--no-renames", "-U0", base, "--").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s: %w", base, gitError(err))
+	}
+	return parseUnifiedDiff(bytes.NewReader(out), strings.TrimSpace(string(top)))
+}
+
+// gitError adds git's own message to a failed command's error.
+func gitError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
+
+// changedLines returns the changed lines of the file at path, or an empty
+// non-nil slice if the diff does not touch it.
+func changedLines(changes map[string][]lineRange, path string) []lineRange {
+	abs, err := filepath.Abs(path)
+	if err == nil {
+		if ranges, ok := changes[abs]; ok {
+			return ranges
+		}
+		// The diff's paths may be under the directory's real path
+		if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+			if ranges, ok := changes[filepath.Join(dir, filepath.Base(abs))]; ok {
+				return ranges
+			}
+		}
+	}
+	return []lineRange{}
+}
+
+// loadDiff reads the unified diff at path, or stdin for "-", with paths
+// relative to the current directory.
+func loadDiff(path string) (map[string][]lineRange, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if path == "-" {
+		return parseUnifiedDiff(os.Stdin, dir)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseUnifiedDiff(f, dir)
+}
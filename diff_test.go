@@ -0,0 +1,117 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUnifiedDiff(t *testing.T) {
+	diff := `diff --git a/docs/a.md b/docs/a.md
+index 1111111..2222222 100644
+--- a/docs/a.md
++++ b/docs/a.md
+@@ -3 +3,2 @@ heading
+-old
++new
++added
+@@ -10,2 +11,0 @@
+-gone
+-gone too
+@@ -20,3 +19,4 @@ context
+ keep
++inserted
+ keep
+ keep
+diff --git a/old.md b/old.md
+deleted file mode 100644
+--- a/old.md
++++ /dev/null
+@@ -1,2 +0,0 @@
+-x
+-y
+--- "a/sp\303\251cial.md"	2024-01-01
++++ "b/sp\303\251cial.md"	2024-01-02
+@@ -1 +1 @@
+--- not a header
+\ No newline at end of file
++++ still content
+\ No newline at end of file
+`
+	changes, err := parseUnifiedDiff(strings.NewReader(diff), "/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]lineRange{
+		// Lines 3-4 replaced, the deletion after line 11, and the
+		// insertion at line 20 (1-based)
+		"/repo/docs/a.md":  {{2, 4}, {10, 12}, {19, 20}},
+		"/repo/spécial.md": {{0, 1}},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("changes = %v, want %v", changes, want)
+	}
+}
+
+func TestProcessFileChangedLines(t *testing.T) {
+	input := "┌──┐\n│ a │\n└──┘\n\tindented\n┌──┐\n│ b │\n└──┘\n"
+	want := "┌──┐\n│ a │\n└──┘\n\tindented\n┌───┐\n│ b │\n└───┘\n"
+
+	opts := defaultOptions()
+	opts.lines = []lineRange{{5, 6}}
+	result, _ := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+
+	opts.lines = []lineRange{}
+	if result, _ := processFile(input, opts); result != input {
+		t.Errorf("file changed with no changed lines:\n%s", result)
+	}
+}
+
+func TestGitDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	writeFile(t, filepath.Join(dir, "docs", "a.md"), "one\ntwo\nthree\n")
+	git("add", ".")
+	git("commit", "-qm", "init")
+	writeFile(t, filepath.Join(dir, "docs", "a.md"), "one\nTWO\nthree\n")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	changes, err := gitDiff("HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := changedLines(changes, "a.md"); !reflect.DeepEqual(got, []lineRange{{1, 2}}) {
+		t.Errorf("changedLines = %v, want [{1 2}]", got)
+	}
+
+	if _, err := gitDiff("no-such-ref"); err == nil || !strings.Contains(err.Error(), "no-such-ref") {
+		t.Errorf("gitDiff(no-such-ref) error = %v", err)
+	}
+}
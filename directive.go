@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// directive is an HTML comment such as `<!-- boxfmt: table align=l,r -->`
+// that configures the box starting on the next non-blank line.
+type directive struct {
+	line int
+	args []directiveArg
+}
+
+type directiveArg struct {
+	key   string
+	value string
+}
+
+func parseDirective(line string) (directive, bool) {
+	s := strings.TrimSpace(line)
+	if !strings.HasPrefix(s, "<!--") || !strings.HasSuffix(s, "-->") {
+		return directive{}, false
+	}
+	s = strings.TrimSpace(s[len("<!--") : len(s)-len("-->")])
+	rest, ok := strings.CutPrefix(s, "boxfmt:")
+	if !ok {
+		return directive{}, false
+	}
+
+	var d directive
+	for _, field := range strings.Fields(rest) {
+		key, value, _ := strings.Cut(field, "=")
+		d.args = append(d.args, directiveArg{key: key, value: value})
+	}
+	return d, true
+}
+
+// apply returns opts as configured by the directive.
+func (d directive) apply(opts options) (options, error) {
+	for _, arg := range d.args {
+		switch arg.key {
+		case "table":
+			opts.toTable = true
+		case "box":
+			opts.fromTable = true
+		case "align":
+			aligns, err := parseAlignments(arg.value)
+			if err != nil {
+				return opts, err
+			}
+			opts.align = aligns
+		case "width":
+			width, err := strconv.Atoi(arg.value)
+			if err != nil || width < 0 {
+				return opts, fmt.Errorf("invalid width %q", arg.value)
+			}
+			opts.width = width
+		case "uniform":
+			opts.uniform = true
+		default:
+			return opts, fmt.Errorf("unknown directive %q", arg.key)
+		}
+	}
+	return opts, nil
+}
+
+// has reports whether the directive sets key.
+func (d directive) has(key string) bool {
+	for _, arg := range d.args {
+		if arg.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveBefore returns the directive on the last non-blank line before
+// line index start, if any.
+func directiveBefore(lines []string, start int) (directive, bool) {
+	for i := start - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+		d, ok := parseDirective(lines[i])
+		d.line = i
+		return d, ok
+	}
+	return directive{}, false
+}
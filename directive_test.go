@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseDirective(t *testing.T) {
+	tests := []struct {
+		input string
+		ok    bool
+		args  []directiveArg
+	}{
+		{"<!-- boxfmt: table -->", true, []directiveArg{{"table", ""}}},
+		{"  <!--boxfmt: align=l,r table-->", true, []directiveArg{{"align", "l,r"}, {"table", ""}}},
+		{"<!-- other comment -->", false, nil},
+		{"boxfmt: table", false, nil},
+	}
+	for _, tt := range tests {
+		d, ok := parseDirective(tt.input)
+		if ok != tt.ok {
+			t.Errorf("parseDirective(%q) ok = %v, want %v", tt.input, ok, tt.ok)
+			continue
+		}
+		if len(d.args) != len(tt.args) {
+			t.Errorf("parseDirective(%q) args = %v, want %v", tt.input, d.args, tt.args)
+			continue
+		}
+		for i := range d.args {
+			if d.args[i] != tt.args[i] {
+				t.Errorf("parseDirective(%q) args = %v, want %v", tt.input, d.args, tt.args)
+				break
+			}
+		}
+	}
+}
+
+func TestDirectiveAlignsBox(t *testing.T) {
+	input := strings.Join([]string{
+		"<!-- boxfmt: align=right,center -->",
+		"┌─┬─┐",
+		"│ a │ b │",
+		"│ 1234 │ 12345 │",
+		"└─┴─┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"<!-- boxfmt: align=right,center -->",
+		"┌──────┬───────┐",
+		"│    a │   b   │",
+		"│ 1234 │ 12345 │",
+		"└──────┴───────┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestUnknownDirective(t *testing.T) {
+	input := "<!-- boxfmt: bogus -->\n┌──┐\n│ A│\n└──┘"
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 1 || diags[0].line != 0 {
+		t.Fatalf("diagnostics = %v, want one on line index 0", diags)
+	}
+	if !strings.Contains(result, "│ A │") {
+		t.Errorf("box was not formatted:\n%s", result)
+	}
+}
+
+func TestDirectiveWidth(t *testing.T) {
+	input := strings.Join([]string{
+		"<!-- boxfmt: width=14 -->",
+		"┌─┐",
+		"│ step 1 │",
+		"└─┘",
+		"",
+		"<!-- boxfmt: width=14 -->",
+		"┌─┬─┐",
+		"│ a │ b │",
+		"└─┴─┘",
+		"",
+		"<!-- boxfmt: width=4 -->",
+		"┌─┐",
+		"│ wider │",
+		"└─┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"<!-- boxfmt: width=14 -->",
+		"┌────────────┐",
+		"│ step 1     │",
+		"└────────────┘",
+		"",
+		"<!-- boxfmt: width=14 -->",
+		"┌───┬────────┐",
+		"│ a │ b      │",
+		"└───┴────────┘",
+		"",
+		"<!-- boxfmt: width=4 -->",
+		"┌───────┐",
+		"│ wider │",
+		"└───────┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+
+	if _, diags := processFile("<!-- boxfmt: width=x -->\n┌─┐\n│ a │\n└─┘\n", defaultOptions()); len(diags) != 1 {
+		t.Errorf("invalid width: diagnostics %v, want one", diags)
+	}
+}
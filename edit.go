@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// textEdit replaces the lines from startLine up to endLine (0-based, end
+// exclusive) with newText. newText holds whole lines including their
+// newlines, except where the file itself ends without one.
+type textEdit struct {
+	startLine int
+	endLine   int
+	newText   string
+}
+
+// formatRange formats the boxes and tables of content that intersect the
+// lines from startLine up to endLine (0-based, end exclusive). Regions are
+// detected over the whole file, so a range covering part of a box formats
+// the entire box. It returns the smallest edit that turns content into
+// the result, or nil if nothing changes.
+func formatRange(content string, startLine, endLine int, opts options) (*textEdit, []diagnostic) {
+	opts.lines = []lineRange{{start: startLine, end: endLine}}
+	result, diags := processFile(content, opts)
+	return minimalEdit(content, result), diags
+}
+
+// minimalEdit returns the edit replacing only the lines that differ
+// between before and after, or nil if they are equal.
+func minimalEdit(before, after string) *textEdit {
+	if before == after {
+		return nil
+	}
+	a := strings.SplitAfter(before, "\n")
+	b := strings.SplitAfter(after, "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	return &textEdit{
+		startLine: prefix,
+		endLine:   len(a) - suffix,
+		newText:   strings.Join(b[prefix:len(b)-suffix], ""),
+	}
+}
+
+// parseLineRange parses a -lines value "start:end" or "line", with 1-based
+// inclusive line numbers, into a 0-based half-open range.
+func parseLineRange(s string) (lineRange, error) {
+	startText, endText, ok := strings.Cut(s, ":")
+	if !ok {
+		endText = startText
+	}
+	start, err := strconv.Atoi(startText)
+	if err != nil {
+		return lineRange{}, fmt.Errorf("invalid start line %q", startText)
+	}
+	end, err := strconv.Atoi(endText)
+	if err != nil {
+		return lineRange{}, fmt.Errorf("invalid end line %q", endText)
+	}
+	if start < 1 || end < start {
+		return lineRange{}, fmt.Errorf("invalid range %q", s)
+	}
+	return lineRange{start: start - 1, end: end}, nil
+}
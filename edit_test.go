@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatRange(t *testing.T) {
+	content := "# Title\n\n┌──┐\n│ a │\n└──┘\n\ntext\n\n┌──┐\n│ b │\n└──┘"
+
+	tests := []struct {
+		name       string
+		start, end int
+		want       *textEdit
+	}{
+		{"first box", 3, 4, &textEdit{startLine: 2, endLine: 5, newText: "┌───┐\n│ a │\n└───┘\n"}},
+		{"last box without newline", 10, 11, &textEdit{startLine: 8, endLine: 11, newText: "┌───┐\n│ b │\n└───┘"}},
+		{"between boxes", 5, 8, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit, _ := formatRange(content, tt.start, tt.end, defaultOptions())
+			if !reflect.DeepEqual(edit, tt.want) {
+				t.Errorf("formatRange(%d, %d) = %+v, want %+v", tt.start, tt.end, edit, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinimalEdit(t *testing.T) {
+	tests := []struct {
+		before, after string
+		want          *textEdit
+	}{
+		{"a\nb\n", "a\nb\n", nil},
+		{"a\nb\nc\n", "a\nB\nc\n", &textEdit{startLine: 1, endLine: 2, newText: "B\n"}},
+		{"a\nb\n", "a\nb\nc\n", &textEdit{startLine: 2, endLine: 2, newText: "c\n"}},
+		{"a\nb\nb\n", "a\nb\n", &textEdit{startLine: 2, endLine: 3, newText: ""}},
+		{"a\nb", "a\nb\n", &textEdit{startLine: 1, endLine: 2, newText: "b\n"}},
+	}
+
+	for _, tt := range tests {
+		if got := minimalEdit(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("minimalEdit(%q, %q) = %+v, want %+v", tt.before, tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    lineRange
+		wantErr bool
+	}{
+		{"3:5", lineRange{2, 5}, false},
+		{"7", lineRange{6, 7}, false},
+		{"0:2", lineRange{}, true},
+		{"5:3", lineRange{}, true},
+		{"a:b", lineRange{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLineRange(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseLineRange(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// editorConfig is a parsed .editorconfig file.
+type editorConfig struct {
+	root     bool
+	path     string
+	sections []editorConfigSection
+}
+
+type editorConfigSection struct {
+	pattern *regexp.Regexp
+	props   map[string]string
+}
+
+// parseEditorConfig parses an .editorconfig file. Keys and values are
+// lowercased, and sections with an invalid glob are skipped.
+func parseEditorConfig(path string) (*editorConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ec := &editorConfig{path: path}
+	var section *editorConfigSection
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = nil
+			re, err := compileGlob(line[1 : len(line)-1])
+			if err != nil {
+				continue
+			}
+			ec.sections = append(ec.sections, editorConfigSection{pattern: re, props: make(map[string]string)})
+			section = &ec.sections[len(ec.sections)-1]
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch {
+		case section != nil:
+			section.props[key] = value
+		case len(ec.sections) == 0 && key == "root":
+			ec.root = value == "true"
+		}
+	}
+	return ec, scanner.Err()
+}
+
+// editorConfigFinder collects the .editorconfig properties for each input
+// file, caching the parsed file of every directory visited.
+type editorConfigFinder struct {
+	cache map[string]*editorConfig
+}
+
+func newEditorConfigFinder() *editorConfigFinder {
+	return &editorConfigFinder{cache: make(map[string]*editorConfig)}
+}
+
+// properties returns the properties that apply to the file at path. Files
+// closer to it override those further up, up to the one with root = true.
+func (f *editorConfigFinder) properties(path string) (map[string]string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*editorConfig
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		ec, err := f.load(dir)
+		if err != nil {
+			return nil, err
+		}
+		if ec != nil {
+			files = append(files, ec)
+			if ec.root {
+				break
+			}
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	props := make(map[string]string)
+	for i := len(files) - 1; i >= 0; i-- {
+		ec := files[i]
+		rel, err := filepath.Rel(filepath.Dir(ec.path), abs)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, s := range ec.sections {
+			if !s.pattern.MatchString(rel) {
+				continue
+			}
+			for k, v := range s.props {
+				props[k] = v
+			}
+		}
+	}
+	return props, nil
+}
+
+func (f *editorConfigFinder) load(dir string) (*editorConfig, error) {
+	if ec, ok := f.cache[dir]; ok {
+		return ec, nil
+	}
+	ec, err := parseEditorConfig(filepath.Join(dir, ".editorconfig"))
+	if errors.Is(err, os.ErrNotExist) {
+		ec, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.cache[dir] = ec
+	return ec, nil
+}
+
+// applyEditorConfig returns opts with the indent_style, tab_width and
+// max_line_length properties applied. tab_width falls back to a numeric
+// indent_size, and values that are not understood are ignored.
+func applyEditorConfig(opts options, props map[string]string) options {
+	switch props["indent_style"] {
+	case "tab":
+		opts.indentTabs = true
+	case "space":
+		opts.indentTabs = false
+	}
+
+	tabWidth, ok := props["tab_width"]
+	if !ok {
+		tabWidth = props["indent_size"]
+	}
+	if n, err := strconv.Atoi(tabWidth); err == nil && n > 0 {
+		opts.tabWidth = n
+	}
+
+	switch v := props["max_line_length"]; v {
+	case "off":
+		opts.maxWidth = 0
+	default:
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			opts.maxWidth = n
+		}
+	}
+	return opts
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+)
+
+func TestEditorConfigProperties(t *testing.T) {
+	dir := t.TempDir()
+	// Not reached: the file below it is the root
+	writeFile(t, filepath.Join(dir, ".editorconfig"), "[*]\ncharset = latin1\n")
+	writeFile(t, filepath.Join(dir, "repo", ".editorconfig"), `root = true
+
+[*]
+indent_style = space
+indent_size = 2
+
+# Markdown
+[*.md]
+max_line_length = 80
+
+[docs/**.md]
+Indent_Style = Tab
+`)
+	writeFile(t, filepath.Join(dir, "repo", "docs", "api", ".editorconfig"), "[*.md]\ntab_width = 8\n")
+
+	finder := newEditorConfigFinder()
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"repo/main.go", map[string]string{"indent_style": "space", "indent_size": "2"}},
+		{"repo/README.md", map[string]string{"indent_style": "space", "indent_size": "2", "max_line_length": "80"}},
+		{"repo/docs/intro.md", map[string]string{"indent_style": "tab", "indent_size": "2", "max_line_length": "80"}},
+		{"repo/docs/api/ref.md", map[string]string{"indent_style": "tab", "indent_size": "2", "max_line_length": "80", "tab_width": "8"}},
+	}
+
+	for _, tt := range tests {
+		props, err := finder.properties(filepath.Join(dir, tt.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !maps.Equal(props, tt.want) {
+			t.Errorf("properties(%s) = %v, want %v", tt.path, props, tt.want)
+		}
+	}
+}
+
+func TestApplyEditorConfig(t *testing.T) {
+	tests := []struct {
+		props    map[string]string
+		tabWidth int
+		tabs     bool
+		maxWidth int
+	}{
+		{map[string]string{}, 4, false, 0},
+		{map[string]string{"indent_style": "tab", "indent_size": "8"}, 8, true, 0},
+		{map[string]string{"indent_size": "2", "tab_width": "3"}, 3, false, 0},
+		{map[string]string{"indent_size": "tab", "max_line_length": "100"}, 4, false, 100},
+		{map[string]string{"tab_width": "0", "max_line_length": "off"}, 4, false, 0},
+	}
+
+	for _, tt := range tests {
+		opts := applyEditorConfig(defaultOptions(), tt.props)
+		if opts.tabWidth != tt.tabWidth || opts.indentTabs != tt.tabs || opts.maxWidth != tt.maxWidth {
+			t.Errorf("applyEditorConfig(%v) = tabWidth %d, indentTabs %v, maxWidth %d; want %d, %v, %d",
+				tt.props, opts.tabWidth, opts.indentTabs, opts.maxWidth, tt.tabWidth, tt.tabs, tt.maxWidth)
+		}
+	}
+}
+
+func TestProcessFileIndentTabs(t *testing.T) {
+	input := "- item\n\t\tkeep\ttabs\n  \t┌──┐\n\t│ a │\n      └──┘\n"
+	want := "- item\n\t\tkeep\ttabs\n\t┌───┐\n\t│ a │\n\t└───┘\n"
+
+	opts := defaultOptions()
+	opts.tabWidth = 6
+	opts.indentTabs = true
+	result, _ := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%q\n--- want ---\n%q", result, want)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// encodingNames maps the names accepted by -encoding to the name used in
+// messages.
+var encodingNames = map[string]string{
+	"utf-8":     "UTF-8",
+	"utf8":      "UTF-8",
+	"sjis":      "Shift_JIS",
+	"shift_jis": "Shift_JIS",
+	"eucjp":     "EUC-JP",
+	"euc-jp":    "EUC-JP",
+	"utf-16":    "UTF-16",
+	"utf-16le":  "UTF-16LE",
+	"utf-16be":  "UTF-16BE",
+}
+
+// parseEncoding returns the canonical name of an encoding accepted by
+// -encoding, or "" for UTF-8.
+func parseEncoding(name string) (string, error) {
+	canonical, ok := encodingNames[strings.ToLower(name)]
+	if !ok {
+		return "", fmt.Errorf("unknown encoding %q (want utf-8, sjis, eucjp or utf-16)", name)
+	}
+	if canonical == "UTF-8" {
+		return "", nil
+	}
+	return canonical, nil
+}
+
+// textEncoding returns the encoding named by parseEncoding. UTF-16 is
+// big-endian if in starts with a big-endian byte order mark, and
+// little-endian otherwise. A byte order mark is decoded like any other
+// character, so that it is written back as it was.
+func textEncoding(name string, in *bufio.Reader) encoding.Encoding {
+	switch name {
+	case "Shift_JIS":
+		return japanese.ShiftJIS
+	case "EUC-JP":
+		return japanese.EUCJP
+	case "UTF-16BE":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case "UTF-16":
+		if bom, _ := in.Peek(2); string(bom) == "\xfe\xff" {
+			return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+		}
+	}
+	return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+}
+
+// transcode returns in decoded from the named encoding into UTF-8, and w
+// wrapped to encode what is written back into it. The writer must be
+// closed to flush it.
+func transcode(name string, in *bufio.Reader, w io.Writer) (*bufio.Reader, io.WriteCloser) {
+	enc := textEncoding(name, in)
+	return bufio.NewReader(transform.NewReader(in, enc.NewDecoder())), transform.NewWriter(w, enc.NewEncoder())
+}
+
+// checkText reports an error if line is not valid UTF-8, or, when decoded
+// from encoding, holds bytes that are not valid in it, which the decoder
+// replaced with U+FFFD.
+func checkText(line, encoding string) error {
+	if encoding == "" {
+		if !utf8.ValidString(line) {
+			return errors.New("invalid UTF-8; use -encoding to read other encodings")
+		}
+		return nil
+	}
+	if strings.ContainsRune(line, utf8.RuneError) {
+		return fmt.Errorf("invalid %s", encoding)
+	}
+	return nil
+}
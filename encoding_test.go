@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestFormatStreamEncodings(t *testing.T) {
+	input := "図\n┌─┐\n│ 日本語 │\n└─┘\n"
+	want := "図\n┌────────┐\n│ 日本語 │\n└────────┘\n"
+
+	tests := []struct {
+		name string
+		enc  encoding.Encoding
+		bom  bool
+	}{
+		{"sjis", japanese.ShiftJIS, false},
+		{"eucjp", japanese.EUCJP, false},
+		{"utf-16", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), false},
+		{"utf-16", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), true},
+		{"utf-16", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), true},
+		{"utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), false},
+	}
+	for _, tt := range tests {
+		in, want := input, want
+		if tt.bom {
+			in, want = byteOrderMark+in, byteOrderMark+want
+		}
+		encoded, err := tt.enc.NewEncoder().String(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wantEncoded, err := tt.enc.NewEncoder().String(want)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		opts := defaultOptions()
+		if opts.encoding, err = parseEncoding(tt.name); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if _, err := formatStream(strings.NewReader(encoded), &out, opts); err != nil {
+			t.Errorf("%s (bom %v): %v", tt.name, tt.bom, err)
+			continue
+		}
+		if out.String() != wantEncoded {
+			t.Errorf("%s (bom %v): got %q, want %q", tt.name, tt.bom, out.String(), wantEncoded)
+		}
+	}
+}
+
+func TestFormatStreamInvalidText(t *testing.T) {
+	sjis := defaultOptions()
+	sjis.encoding = "Shift_JIS"
+
+	tests := []struct {
+		name  string
+		input string
+		opts  options
+		line  int
+		want  string
+	}{
+		{"utf-8", "ok\n\xff\xfe\n", defaultOptions(), 1, "invalid UTF-8"},
+		{"sjis", "ok\nok\n\x81\n", sjis, 2, "invalid Shift_JIS"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		_, err := formatStream(strings.NewReader(tt.input), &out, tt.opts)
+		d, ok := err.(diagnostic)
+		if !ok {
+			t.Errorf("%s: error %v, want a diagnostic", tt.name, err)
+			continue
+		}
+		if d.line != tt.line || !strings.Contains(d.message, tt.want) {
+			t.Errorf("%s: error %v, want %q on line %d", tt.name, d, tt.want, tt.line+1)
+		}
+	}
+
+	// processFile leaves invalid text as it is
+	input := "┌─┐\n│ a │\n└─┘\n\xff\n"
+	got, diags := processFile(input, defaultOptions())
+	if got != input {
+		t.Errorf("processFile changed invalid text: %q", got)
+	}
+	if len(diags) != 1 || diags[0].line != 3 {
+		t.Errorf("diagnostics %v, want one on line 4", diags)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for name, want := range map[string]string{"utf-8": "", "UTF8": "", "sjis": "Shift_JIS", "EUC-JP": "EUC-JP", "utf-16": "UTF-16"} {
+		got, err := parseEncoding(name)
+		if err != nil || got != want {
+			t.Errorf("parseEncoding(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := parseEncoding("latin1"); err == nil {
+		t.Error("parseEncoding(latin1) succeeded")
+	}
+}
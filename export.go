@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// parseBox parses a box of any shape into a table. A single-column box
+// becomes one column whose cells keep their leading spaces, since such
+// boxes often hold indented text or diagrams; escaped verticals are only
+// unescaped in multi-column boxes, where they mean something.
+func parseBox(region boxRegion, opts options) (boxTable, error) {
+	layout := detectColumns(region)
+	if len(layout.separators) > 0 {
+		table, err := parseBoxTable(region, layout, opts)
+		if err != nil {
+			return table, err
+		}
+		for _, row := range table.cells {
+			for j := range row {
+				row[j].text = unescapeCellText(row[j].text)
+			}
+		}
+		return table, nil
+	}
+
+	table := boxTable{
+		numCols: 1,
+		cells:   make([][]cell, len(region.lines)),
+		active:  make([][]bool, len(region.lines)),
+		align:   []alignment{alignDefault},
+	}
+	for i, cl := range region.lines {
+		if cl.typ == lineContent {
+			text := strings.TrimRight(extractContentText(cl.trimmed), " ")
+			table.cells[i] = []cell{{text: text, span: 1}}
+		}
+	}
+	return table, nil
+}
+
+// exportSVG writes every box in content to dir as <name>-<region>.svg and
+// returns the paths written.
+func exportSVG(content, name, dir string, opts options) ([]string, []diagnostic, error) {
+	lines, _ := splitLines(content, opts.tabWidth)
+	regions := detectBoxRegions(classifyLines(lines), opts)
+
+	var paths []string
+	var diags []diagnostic
+	for i, region := range regions {
+		table, err := parseBox(region, opts)
+		if err != nil {
+			var d diagnostic
+			if !errors.As(err, &d) {
+				d = diagnostic{line: region.startIdx, message: err.Error()}
+			}
+			diags = append(diags, d)
+			continue
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("%s-%d.svg", name, i))
+		if err := os.WriteFile(path, []byte(renderSVG(region, table)), 0644); err != nil {
+			return paths, diags, err
+		}
+		paths = append(paths, path)
+	}
+	return paths, diags, nil
+}
+
+// runExport implements the export subcommand, which renders the boxes of a
+// document as SVG images or as HTML blocks within the document.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "html", "output format: html or svg")
+	dir := fs.String("dir", ".", "directory to write SVG files to")
+	output := fs.String("o", "", "output file path for HTML")
+	repair := fs.Bool("repair", false, "also export boxes with a missing edge or border")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: boxfmt export [options] <file>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 1
+	}
+
+	inputPath := fs.Arg(0)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	opts := defaultOptions()
+	opts.repair = *repair
+
+	switch *format {
+	case "svg":
+		name := strings.TrimSuffix(filepath.Base(inputPath), filepath.Ext(inputPath))
+		paths, diags, err := exportSVG(string(data), name, *dir, opts)
+		for _, d := range diags {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", inputPath, d.line+1, d.message)
+		}
+		for _, path := range paths {
+			fmt.Println(path)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+	case "html":
+		opts.toHTML = true
+		result, diags := processFile(string(data), opts)
+		for _, d := range diags {
+			fmt.Fprintf(os.Stderr, "%s:%d: %s\n", inputPath, d.line+1, d.message)
+		}
+		if *output != "" {
+			if err := os.WriteFile(*output, []byte(result), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				return 1
+			}
+			return 0
+		}
+		fmt.Print(result)
+	default:
+		fmt.Fprintf(os.Stderr, "error: -format: unknown format %q\n", *format)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseBoxSingleColumn(t *testing.T) {
+	lines := []string{"┌──────┐", "│ root │", "│   └─ child │", "└──────┘"}
+	region := detectBoxRegions(classifyLines(lines), defaultOptions())[0]
+	table, err := parseBox(region, defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.numCols != 1 {
+		t.Fatalf("numCols = %d, want 1", table.numCols)
+	}
+	if got := table.cells[2][0].text; got != "  └─ child" {
+		t.Errorf("cell text = %q, want leading spaces kept", got)
+	}
+}
+
+func TestExportSVG(t *testing.T) {
+	dir := t.TempDir()
+	content := "┌──┐\n│ a │\n└──┘\n\n┌──┬──┐\n│ a │ b │ c │\n└──┴──┘\n\n+--+--+\n| x | y |\n+--+--+\n"
+
+	paths, diags, err := exportSVG(content, "doc", dir, defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diags) != 1 || diags[0].line != 5 {
+		t.Errorf("diagnostics = %v, want one on line index 5", diags)
+	}
+	want := []string{filepath.Join(dir, "doc-0.svg"), filepath.Join(dir, "doc-2.svg")}
+	if strings.Join(paths, ",") != strings.Join(want, ",") {
+		t.Fatalf("paths = %v, want %v", paths, want)
+	}
+	data, err := os.ReadFile(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<svg ") {
+		t.Errorf("not an SVG file:\n%s", data)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExtractBoxes(t *testing.T) {
+	input := strings.Join([]string{
+		"# Doc",
+		"",
+		"┌──┬──┐",
+		"│ Name│ 説明 │",
+		"├──┼──┤",
+		"│ cmd │ a \\| b │",
+		"└──┴──┘",
+		"",
+		"+----+",
+		"| x | y |",
+		"+----+",
+	}, "\n")
+
+	boxes := extractBoxes(input, defaultOptions())
+	if len(boxes) != 2 {
+		t.Fatalf("expected 2 boxes, got %d", len(boxes))
+	}
+
+	first := boxes[0]
+	if first.Region != 0 || first.StartLine != 3 || first.EndLine != 7 {
+		t.Errorf("first box = region %d lines %d-%d, want region 0 lines 3-7", first.Region, first.StartLine, first.EndLine)
+	}
+	if len(first.Rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(first.Rows))
+	}
+	if row := first.Rows[1]; row.Line != 6 || row.Section != 1 || strings.Join(row.Cells, ",") != "cmd,a | b" {
+		t.Errorf("second row = %+v", row)
+	}
+
+	// Single-column boxes keep inner verticals as text
+	if cells := boxes[1].Rows[0].Cells; len(cells) != 1 || cells[0] != "x | y" {
+		t.Errorf("single-column cells = %q", cells)
+	}
+}
+
+func TestWriteExtracted(t *testing.T) {
+	boxes := []extractedBox{{
+		Region:    0,
+		StartLine: 1,
+		EndLine:   4,
+		Rows: []extractedRow{
+			{Line: 2, Cells: []string{"a", "b, c"}},
+			{Line: 3, Section: 1, Cells: []string{"d", "e"}},
+		},
+	}}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"csv", "0,2,a,\"b, c\"\n0,3,d,e\n"},
+		{"tsv", "0\t2\ta\tb, c\n0\t3\td\te\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := writeExtracted(&buf, boxes, tt.format); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s output = %q, want %q", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeExtracted(&buf, boxes, "json"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"region": 0`, `"startLine": 1`, `"section": 1`, `"b, c"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("JSON output lacks %s:\n%s", want, buf.String())
+		}
+	}
+}
@@ -1,146 +1,437 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
 	"strings"
 )
 
-func fixBoxRegion(region boxRegion) []string {
-	columns := detectColumns(region)
-	if len(columns) == 0 {
-		return fixSingleColumnBox(region)
-	}
-	return fixMultiColumnBox(region, columns)
+// diagnostic reports a box that was left unformatted and why.
+type diagnostic struct {
+	line    int // 0-based line index in the input
+	message string
 }
 
-// detectColumns returns column separator positions from the first border line.
-// Returns nil or single-element slice for single-column boxes.
-func detectColumns(region boxRegion) []int {
-	if len(region.lines) == 0 {
-		return nil
+func (d diagnostic) Error() string {
+	return fmt.Sprintf("line %d: %s", d.line+1, d.message)
+}
+
+func fixBoxRegion(region boxRegion, opts options) ([]string, error) {
+	if opts.toHTML {
+		return boxToHTML(region, opts)
 	}
 
-	border := region.lines[0].trimmed
-	runes := []rune(border)
+	layout := detectColumns(region)
+	if len(layout.separators) == 0 {
+		return fixSingleColumnBox(region, opts), nil
+	}
+	return fixMultiColumnBox(region, layout, opts)
+}
 
-	var separators []int
-	for i, r := range runes {
-		if i == 0 || i == len(runes)-1 {
-			continue
-		}
-		if r == '┬' || r == '┴' || r == '┼' {
-			separators = append(separators, i)
+func fixSingleColumnBox(region boxRegion, opts options) []string {
+	contentLines, maxWidth, opts := wrapSingleColumn(region, opts)
+	pad := opts.padLeft + opts.padRight
+	if opts.width > 0 {
+		maxWidth = max(maxWidth, opts.width-pad-2)
+	}
+	left := strings.Repeat(" ", opts.padLeft)
+	right := strings.Repeat(" ", opts.padRight)
+
+	// Rebuild lines
+	result := make([]string, 0, len(region.lines))
+	row := 0
+	for _, cl := range region.lines {
+		switch cl.typ {
+		case lineTopBorder, lineBottomBorder, lineDivider:
+			result = append(result, region.indent+buildBorderLine(cl, maxWidth+pad))
+		case lineContent:
+			leftV, rightV := getVerticalChars(cl)
+			for _, text := range contentLines[row] {
+				padded := fillRight(text, maxWidth)
+				result = append(result, region.indent+string(leftV)+left+padded+right+string(rightV))
+			}
+			row++
 		}
-		if r == '+' && region.lines[0].isASCII {
-			separators = append(separators, i)
+	}
+
+	return result
+}
+
+// wrapSingleColumn returns the text of each content line of a
+// single-column box, wrapped into several lines if the box is wider than
+// opts.maxWidth, and the width of the text. The returned opts widen the box
+// to no more than opts.maxWidth: column widths shared with other boxes are
+// dropped from a box they would make too wide, before or after wrapping. A
+// box that cannot be narrowed enough is left as it is.
+func wrapSingleColumn(region boxRegion, opts options) ([][]string, int, options) {
+	texts := singleColumnTexts(region, opts)
+	width := singleColumnWidth(texts, opts)
+	lines := make([][]string, len(texts))
+	for i, text := range texts {
+		lines[i] = []string{text}
+	}
+	if opts.maxWidth <= 0 {
+		return lines, width, opts
+	}
+
+	limit := opts.maxWidth - stringWidth(region.indent)
+	opts.width = min(opts.width, limit)
+	if boxWidth([]int{width}, opts) <= limit {
+		return lines, width, opts
+	}
+	shared := opts.columnWidths
+	opts.columnWidths = nil
+	width = singleColumnWidth(texts, opts)
+	fitted, wrapped := fitWidths([]int{width}, limit, opts)
+	if !wrapped || boxWidth(fitted, opts) > limit {
+		return lines, width, opts
+	}
+	wrappedLines := make([][]string, len(texts))
+	wrappedWidth := opts.minColumnWidth
+	for i, text := range texts {
+		wrappedLines[i] = wrapCell(text, fitted[0])
+		for _, line := range wrappedLines[i] {
+			wrappedWidth = max(wrappedWidth, stringWidth(line))
 		}
 	}
+	// Wide characters cannot be split to fit a narrower column
+	if boxWidth([]int{wrappedWidth}, opts) > limit {
+		return lines, width, opts
+	}
+	if len(shared) == 1 && boxWidth(shared, opts) <= limit {
+		opts.columnWidths = shared
+		wrappedWidth = max(wrappedWidth, shared[0])
+	}
+	return wrappedLines, wrappedWidth, opts
+}
 
-	return separators
+// cell is the text of one cell in a content row. A cell spans one or
+// more columns of the box; span > 1 means horizontally merged cells.
+type cell struct {
+	text  string
+	col   int
+	span  int
+	lead  int // spaces before the text in the source line
+	trail int // spaces after the text in the source line
 }
 
-func fixSingleColumnBox(region boxRegion) []string {
-	// Extract content texts and compute max width
-	var contentTexts []string
-	var contentIndices []int
+// boxTable is the parsed content of a multi-column box. cells and active
+// are indexed like the region's lines: content lines have cells, and every
+// line has the active boundaries of its section; for a border line, that is
+// the section below it.
+type boxTable struct {
+	numCols int
+	cells   [][]cell
+	active  [][]bool
+	align   []alignment
+}
 
+// sections returns the rows of cells between each pair of border lines,
+// skipping sections without content.
+func (t boxTable) sections(region boxRegion) [][][]cell {
+	var sections [][][]cell
+	var current [][]cell
 	for i, cl := range region.lines {
 		if cl.typ == lineContent {
-			text := extractContentText(cl.trimmed)
-			contentTexts = append(contentTexts, text)
-			contentIndices = append(contentIndices, i)
+			current = append(current, t.cells[i])
+			continue
+		}
+		if len(current) > 0 {
+			sections = append(sections, current)
 		}
+		current = nil
 	}
+	return sections
+}
 
-	maxWidth := 0
-	for _, text := range contentTexts {
-		w := stringWidth(text)
-		if w > maxWidth {
-			maxWidth = w
+func fixMultiColumnBox(region boxRegion, layout columnLayout, opts options) ([]string, error) {
+	table, err := parseBoxTable(region, layout, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.toTable {
+		if lines, err := boxToMarkdownTable(region, table, opts); lines != nil || err != nil {
+			return lines, err
 		}
 	}
+	if opts.maxWidth > 0 {
+		region, table, opts = wrapBoxTable(region, table, opts)
+	}
+	return renderBoxTable(region, table, opts), nil
+}
 
-	// Rebuild lines
-	result := make([]string, len(region.lines))
-	for i, cl := range region.lines {
-		switch cl.typ {
-		case lineTopBorder:
-			result[i] = region.indent + buildBorderLine(cl, maxWidth)
-		case lineBottomBorder:
-			result[i] = region.indent + buildBorderLine(cl, maxWidth)
-		case lineDivider:
-			result[i] = region.indent + buildBorderLine(cl, maxWidth)
-		case lineContent:
-			text := extractContentText(cl.trimmed)
-			leftV, rightV := getVerticalChars(cl)
-			padded := fillRight(text, maxWidth)
-			result[i] = region.indent + string(leftV) + " " + padded + " " + string(rightV)
-		}
+// wrapBoxTable wraps the cells of a box wider than opts.maxWidth so that it
+// fits, returning the box with its content lines wrapped. The returned opts
+// widen the box to no more than opts.maxWidth, as in wrapSingleColumn. When
+// each content line is a row of its own, as in a box with no more than a
+// header divider, the rows of a wrapped box are separated by dividers, as
+// in drawBox.
+func wrapBoxTable(region boxRegion, table boxTable, opts options) (boxRegion, boxTable, options) {
+	limit := opts.maxWidth - stringWidth(region.indent)
+	opts.width = min(opts.width, limit)
+	if boxWidth(columnWidths(table.cells, table.numCols, opts), opts) <= limit {
+		return region, table, opts
 	}
+	shared := opts.columnWidths
+	opts.columnWidths = nil
+	widths, wrapped := fitWidths(columnWidths(table.cells, table.numCols, opts), limit, opts)
+	if !wrapped || boxWidth(widths, opts) > limit {
+		return region, table, opts
+	}
+	linesAreRows := len(table.sections(region)) <= 2
 
-	return result
-}
+	wrappedRegion := region
+	wrappedRegion.lines = nil
+	wrappedTable := table
+	wrappedTable.cells, wrappedTable.active = nil, nil
+	add := func(cl classifiedLine, cells []cell, active []bool) {
+		wrappedRegion.lines = append(wrappedRegion.lines, cl)
+		wrappedTable.cells = append(wrappedTable.cells, cells)
+		wrappedTable.active = append(wrappedTable.active, active)
+	}
+	for i, cl := range region.lines {
+		if cl.typ != lineContent {
+			add(cl, table.cells[i], table.active[i])
+			continue
+		}
+		if linesAreRows && region.lines[i-1].typ == lineContent {
+			add(classifiedLine{typ: lineDivider, isASCII: cl.isASCII, lineNum: cl.lineNum}, nil, table.active[i])
+		}
 
-func fixMultiColumnBox(region boxRegion, separators []int) []string {
-	// Parse columns from content lines
-	numCols := len(separators) + 1
-	colContents := make([][]string, numCols)
-	for i := range colContents {
-		colContents[i] = []string{}
+		texts := make([][]string, len(table.cells[i]))
+		height := 1
+		for j, c := range table.cells[i] {
+			texts[j] = wrapCell(c.text, spanWidth(widths, c, opts.cellGap()))
+			height = max(height, len(texts[j]))
+		}
+		for l := range height {
+			cells := slices.Clone(table.cells[i])
+			for j := range cells {
+				cells[j].text = ""
+				if l < len(texts[j]) {
+					cells[j].text = texts[j][l]
+				}
+			}
+			add(cl, cells, table.active[i])
+		}
 	}
+	// Wide characters cannot be split to fit a narrower column
+	if boxWidth(columnWidths(wrappedTable.cells, table.numCols, opts), opts) > limit {
+		return region, table, opts
+	}
+	sharedOpts := opts
+	sharedOpts.columnWidths = shared
+	if boxWidth(columnWidths(wrappedTable.cells, table.numCols, sharedOpts), opts) <= limit {
+		opts = sharedOpts
+	}
+	return wrappedRegion, wrappedTable, opts
+}
 
-	var contentIndices []int
-	var contentCols [][]string
+func parseBoxTable(region boxRegion, layout columnLayout, opts options) (boxTable, error) {
+	numCols := len(layout.separators) + 1
+	joints := layout.joints
 
+	// Split content lines into cells and group them into sections
+	// delimited by border lines.
+	rowCells := make([][]string, len(region.lines))
+	rowPads := make([][][2]int, len(region.lines))
+	var sections [][]int
+	var current []int
+	upper := 0
+	active := make([][]bool, len(region.lines))
 	for i, cl := range region.lines {
 		if cl.typ == lineContent {
-			cols := splitContentColumns(cl.trimmed, numCols)
-			contentCols = append(contentCols, cols)
-			contentIndices = append(contentIndices, i)
-			for c := 0; c < numCols; c++ {
-				if c < len(cols) {
-					colContents[c] = append(colContents[c], cols[c])
+			rowCells[i] = splitContentColumns(cl.trimmed, numCols)
+			rowPads[i] = cellPadding(cl.trimmed)
+			current = append(current, i)
+			continue
+		}
+		if i > 0 {
+			sectionActive := sectionBoundaries(joints[upper], joints[i], rowCells, current)
+			for _, row := range current {
+				active[row] = sectionActive
+			}
+			active[upper] = sectionActive
+			sections = append(sections, current)
+		}
+		current = nil
+		upper = i
+	}
+
+	// Map cells onto columns, refusing rows that would lose content.
+	cells := make([][]cell, len(region.lines))
+	for _, section := range sections {
+		for _, row := range section {
+			texts := rowCells[row]
+			starts := cellStarts(active[row])
+			if len(texts) > len(starts) {
+				return boxTable{}, diagnostic{
+					line:    region.lines[row].lineNum,
+					message: fmt.Sprintf("row has %d cells but only %d columns; box left unchanged", len(texts), len(starts)),
+				}
+			}
+			if len(texts) < len(starts) && !opts.padCells && !allEmpty(texts) {
+				return boxTable{}, diagnostic{
+					line:    region.lines[row].lineNum,
+					message: fmt.Sprintf("row has %d cells, expected %d; box left unchanged (use -pad-cells to fill)", len(texts), len(starts)),
 				}
 			}
+			for j, start := range starts {
+				end := numCols
+				if j+1 < len(starts) {
+					end = starts[j+1]
+				}
+				c := cell{col: start, span: end - start}
+				if j < len(texts) {
+					c.text = texts[j]
+					c.lead, c.trail = rowPads[row][j][0], rowPads[row][j][1]
+				}
+				cells[row] = append(cells[row], c)
+			}
 		}
 	}
 
-	// Compute max width for each column
-	maxWidths := make([]int, numCols)
-	for c := 0; c < numCols; c++ {
-		for _, text := range colContents[c] {
-			w := stringWidth(text)
-			if w > maxWidths[c] {
-				maxWidths[c] = w
+	// Spaces before kept indentation do not show an alignment
+	align := make([]alignment, numCols)
+	if !opts.preserveIndent {
+		align = inferAlignments(cells, numCols, opts)
+	}
+	align = mergeAlignments(align, opts.align)
+	if opts.preserveIndent {
+		keepCellIndents(cells, align)
+	}
+	return boxTable{numCols: numCols, cells: cells, active: active, align: align}, nil
+}
+
+// keepCellIndents puts back the spaces before the text of each cell beyond
+// the fewest before any text in its column. Only left-aligned columns are
+// indented; in others, the spaces come from the alignment.
+func keepCellIndents(cells [][]cell, align []alignment) {
+	shared := make([]int, len(align))
+	for col := range shared {
+		shared[col] = -1
+	}
+	for _, row := range cells {
+		for _, c := range row {
+			if c.text != "" && (shared[c.col] < 0 || c.lead < shared[c.col]) {
+				shared[c.col] = c.lead
 			}
 		}
 	}
 
-	// Rebuild lines
-	result := make([]string, len(region.lines))
-	contentIdx := 0
+	for _, row := range cells {
+		for j, c := range row {
+			if c.text == "" || (align[c.col] != alignDefault && align[c.col] != alignLeft) {
+				continue
+			}
+			if extra := c.lead - shared[c.col]; extra > 0 {
+				row[j].text = strings.Repeat(" ", extra) + c.text
+				row[j].lead = shared[c.col]
+			}
+		}
+	}
+}
+
+// inferAlignments guesses the alignment of each column from how its cells
+// are padded, so that aligned boxes keep their alignment when reformatted.
+// Only a column whose cells all end at the same place, with texts of
+// different widths, shows an alignment: it is right-aligned when every cell
+// hugs the right edge, and centered when every cell is padded evenly on
+// both sides, provided some cell does not also hug the left edge. Edges are
+// measured inside the padding set in opts. Misaligned columns are left as
+// they are to be fixed.
+func inferAlignments(cells [][]cell, numCols int, opts options) []alignment {
+	aligns := make([]alignment, numCols)
+	for col := range aligns {
+		right, center, shifted := true, true, false
+		drawn, narrowest, widest := -1, -1, 0
+		for _, row := range cells {
+			for _, c := range row {
+				if c.col != col || c.span != 1 || c.text == "" {
+					continue
+				}
+				w := stringWidth(c.text)
+				if total := c.lead + w + c.trail; drawn >= 0 && total != drawn {
+					right, center = false, false
+				} else {
+					drawn = total
+				}
+				if narrowest < 0 || w < narrowest {
+					narrowest = w
+				}
+				widest = max(widest, w)
+
+				lead, trail := c.lead-opts.padLeft, c.trail-opts.padRight
+				if trail != 0 {
+					right = false
+				}
+				if d := trail - lead; lead < 0 || d < 0 || d > 1 {
+					center = false
+				}
+				if lead > 0 {
+					shifted = true
+				}
+			}
+		}
+		if !shifted || narrowest == widest {
+			continue
+		}
+		switch {
+		case right:
+			aligns[col] = alignRight
+		case center:
+			aligns[col] = alignCenter
+		}
+	}
+	return aligns
+}
 
+// mergeAlignments returns base with every column that override sets to a
+// non-default alignment replaced.
+func mergeAlignments(base, override []alignment) []alignment {
+	merged := slices.Clone(base)
+	for col, a := range override {
+		if col < len(merged) && a != alignDefault {
+			merged[col] = a
+		}
+	}
+	return merged
+}
+
+func renderBoxTable(region boxRegion, table boxTable, opts options) []string {
+	maxWidths := columnWidths(table.cells, table.numCols, opts)
+	if opts.width > 0 {
+		// The last column takes up the rest of the width
+		if extra := opts.width - boxWidth(maxWidths, opts); extra > 0 {
+			maxWidths[len(maxWidths)-1] += extra
+		}
+	}
+	active := table.active
+	pad := opts.padLeft + opts.padRight
+	left := strings.Repeat(" ", opts.padLeft)
+	right := strings.Repeat(" ", opts.padRight)
+
+	// Rebuild lines. Each border joins the sections above and below it.
+	result := make([]string, len(region.lines))
+	var above []bool
 	for i, cl := range region.lines {
 		switch cl.typ {
 		case lineTopBorder:
-			result[i] = region.indent + buildMultiColBorderLine(cl, maxWidths, getTopBorderChars(cl))
+			result[i] = region.indent + buildSectionBorderLine(maxWidths, pad, getTopBorderChars(cl), nil, active[i])
 		case lineBottomBorder:
-			result[i] = region.indent + buildMultiColBorderLine(cl, maxWidths, getBottomBorderChars(cl))
+			result[i] = region.indent + buildSectionBorderLine(maxWidths, pad, getBottomBorderChars(cl), above, nil)
 		case lineDivider:
-			result[i] = region.indent + buildMultiColBorderLine(cl, maxWidths, getDividerChars(cl))
+			result[i] = region.indent + buildSectionBorderLine(maxWidths, pad, getDividerChars(cl), above, active[i])
 		case lineContent:
-			cols := contentCols[contentIdx]
-			contentIdx++
 			leftV, rightV := getVerticalChars(cl)
 			var buf strings.Builder
 			buf.WriteRune(leftV)
-			for c := 0; c < numCols; c++ {
-				text := ""
-				if c < len(cols) {
-					text = cols[c]
-				}
-				padded := fillRight(text, maxWidths[c])
-				buf.WriteString(" " + padded + " ")
-				if c < numCols-1 {
+			for j, c := range table.cells[i] {
+				padded := fillAligned(c.text, spanWidth(maxWidths, c, opts.cellGap()), table.align[c.col])
+				buf.WriteString(left + padded + right)
+				if j < len(table.cells[i])-1 {
 					// Use inner vertical separator
 					buf.WriteRune(getInnerVertical(cl))
 				}
@@ -148,11 +439,147 @@ func fixMultiColumnBox(region boxRegion, separators []int) []string {
 			buf.WriteRune(rightV)
 			result[i] = region.indent + buf.String()
 		}
+		if cl.typ != lineContent {
+			above = active[i]
+		}
 	}
 
 	return result
 }
 
+// sectionBoundaries decides which column boundaries are drawn through the
+// content rows between two border lines. Boundaries drawn by both borders
+// are used when they account for every cell; otherwise boundaries drawn by
+// either border are.
+func sectionBoundaries(upper, lower []joint, rowCells [][]string, rows []int) []bool {
+	union := make([]bool, len(upper))
+	inter := make([]bool, len(upper))
+	nUnion, nInter := 0, 0
+	for k := range upper {
+		union[k] = upper[k].down || lower[k].up
+		inter[k] = upper[k].down && lower[k].up
+		if union[k] {
+			nUnion++
+		}
+		if inter[k] {
+			nInter++
+		}
+	}
+
+	want := 0
+	for _, row := range rows {
+		if n := len(rowCells[row]); n > want {
+			want = n
+		}
+	}
+	if nInter != nUnion && nInter+1 == want {
+		return inter
+	}
+	return union
+}
+
+// cellStarts returns the first column of each cell in a row whose drawn
+// boundaries are active.
+func cellStarts(active []bool) []int {
+	starts := []int{0}
+	for k, on := range active {
+		if on {
+			starts = append(starts, k+1)
+		}
+	}
+	return starts
+}
+
+func allEmpty(texts []string) bool {
+	for _, text := range texts {
+		if text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// boxWidth is the width of a box, including its borders, whose columns
+// have the given content widths.
+func boxWidth(widths []int, opts options) int {
+	total := 1
+	for _, w := range widths {
+		total += w + opts.cellGap()
+	}
+	return total
+}
+
+// columnWidths computes the content width of each column, at least
+// opts.minColumnWidth and opts.columnWidths. Merged cells that do not fit
+// the columns they span widen the last of those columns.
+func columnWidths(cells [][]cell, numCols int, opts options) []int {
+	widths := make([]int, numCols)
+	for c := range widths {
+		widths[c] = opts.minColumnWidth
+		if len(opts.columnWidths) == numCols {
+			widths[c] = max(widths[c], opts.columnWidths[c])
+		}
+	}
+	var merged []cell
+	for _, row := range cells {
+		for _, c := range row {
+			if c.span > 1 {
+				merged = append(merged, c)
+				continue
+			}
+			if w := stringWidth(c.text); w > widths[c.col] {
+				widths[c.col] = w
+			}
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].span < merged[j].span })
+	for _, c := range merged {
+		if need := stringWidth(c.text) - spanWidth(widths, c, opts.cellGap()); need > 0 {
+			widths[c.col+c.span-1] += need
+		}
+	}
+
+	return widths
+}
+
+// spanWidth is the content width available to c, including the padding
+// and separators of the inner boundaries it covers, which are gap wide.
+func spanWidth(widths []int, c cell, gap int) int {
+	w := gap * (c.span - 1)
+	for _, cw := range widths[c.col : c.col+c.span] {
+		w += cw
+	}
+	return w
+}
+
+// singleColumnTexts returns the text of each content line of a
+// single-column box.
+func singleColumnTexts(region boxRegion, opts options) []string {
+	if opts.preserveIndent {
+		return indentedContentTexts(region.lines)
+	}
+	var texts []string
+	for _, cl := range region.lines {
+		if cl.typ == lineContent {
+			texts = append(texts, stripPadding(extractContentText(cl.trimmed), opts.padLeft-1, opts.padRight-1))
+		}
+	}
+	return texts
+}
+
+// singleColumnWidth is the width of the text of a single-column box.
+func singleColumnWidth(texts []string, opts options) int {
+	width := opts.minColumnWidth
+	if len(opts.columnWidths) == 1 {
+		width = max(width, opts.columnWidths[0])
+	}
+	for _, text := range texts {
+		width = max(width, stringWidth(text))
+	}
+	return width
+}
+
 func extractContentText(trimmed string) string {
 	runes := []rune(trimmed)
 	if len(runes) < 2 {
@@ -172,35 +599,138 @@ func extractContentText(trimmed string) string {
 	return inner
 }
 
+// stripPadding removes up to left leading and up to right trailing spaces
+// from text, the padding beyond the one space extractContentText removes.
+func stripPadding(text string, left, right int) string {
+	for ; left > 0 && strings.HasPrefix(text, " "); left-- {
+		text = text[1:]
+	}
+	for ; right > 0 && strings.HasSuffix(text, " "); right-- {
+		text = text[:len(text)-1]
+	}
+	return text
+}
+
+// indentedContentTexts returns the text of each content line with the
+// indentation that all of them share removed and trailing spaces trimmed.
+// Blank lines do not count towards the shared indentation.
+func indentedContentTexts(lines []classifiedLine) []string {
+	var inners []string
+	shared := -1
+	for _, cl := range lines {
+		if cl.typ != lineContent {
+			continue
+		}
+		runes := []rune(cl.trimmed)
+		inner := ""
+		if len(runes) >= 2 {
+			inner = strings.TrimRight(string(runes[1:len(runes)-1]), " ")
+		}
+		inners = append(inners, inner)
+		if inner == "" {
+			continue
+		}
+		if lead := len(inner) - len(strings.TrimLeft(inner, " ")); shared < 0 || lead < shared {
+			shared = lead
+		}
+	}
+	for i, inner := range inners {
+		if inner != "" {
+			inners[i] = inner[shared:]
+		}
+	}
+	return inners
+}
+
 func splitContentColumns(trimmed string, numCols int) []string {
 	runes := []rune(trimmed)
 	if len(runes) < 2 {
 		return nil
 	}
 
-	// Remove outer verticals
-	inner := runes[1 : len(runes)-1]
-
-	// Split by inner vertical characters (│ or |)
+	// Split by inner vertical characters (│ or |) between the outer verticals
 	var cols []string
-	var current []rune
-
-	for _, r := range inner {
-		if isVertical(r) {
-			text := strings.TrimSpace(string(current))
-			cols = append(cols, text)
-			current = nil
-		} else {
-			current = append(current, r)
-		}
+	start := 1
+	for _, sep := range cellSeparators(runes) {
+		cols = append(cols, strings.TrimSpace(string(runes[start:sep])))
+		start = sep + 1
 	}
 	// Last column
-	text := strings.TrimSpace(string(current))
-	cols = append(cols, text)
+	cols = append(cols, strings.TrimSpace(string(runes[start:len(runes)-1])))
 
 	return cols
 }
 
+// cellPadding returns the number of spaces before and after the text of
+// each cell of a content line, in the same order as splitContentColumns.
+func cellPadding(trimmed string) [][2]int {
+	runes := []rune(trimmed)
+	if len(runes) < 2 {
+		return nil
+	}
+
+	var pads [][2]int
+	start := 1
+	for _, sep := range append(cellSeparators(runes), len(runes)-1) {
+		segment := string(runes[start:sep])
+		trimmedLeft := strings.TrimLeft(segment, " ")
+		lead := len(segment) - len(trimmedLeft)
+		trail := len(trimmedLeft) - len(strings.TrimRight(trimmedLeft, " "))
+		pads = append(pads, [2]int{lead, trail})
+		start = sep + 1
+	}
+	return pads
+}
+
+// cellSeparators returns the indices of the inner verticals that separate
+// cells in a content line. A vertical escaped with a backslash (\|) or
+// inside an inline code span is part of the cell text.
+func cellSeparators(runes []rune) []int {
+	var seps []int
+	end := len(runes) - 1
+	for i := 1; i < end; i++ {
+		switch r := runes[i]; {
+		case r == '\\' && i+1 < end && isVertical(runes[i+1]):
+			i++
+		case r == '`':
+			n := backtickRun(runes[:end], i)
+			if closing := closingBackticks(runes[:end], i+n, n); closing >= 0 {
+				i = closing + n - 1
+			} else {
+				i += n - 1
+			}
+		case isVertical(r):
+			seps = append(seps, i)
+		}
+	}
+	return seps
+}
+
+func backtickRun(runes []rune, i int) int {
+	n := 0
+	for i+n < len(runes) && runes[i+n] == '`' {
+		n++
+	}
+	return n
+}
+
+// closingBackticks returns the index of the next run of exactly n
+// backticks at or after from, or -1 if the code span is never closed.
+func closingBackticks(runes []rune, from, n int) int {
+	for i := from; i < len(runes); {
+		if runes[i] != '`' {
+			i++
+			continue
+		}
+		run := backtickRun(runes, i)
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
 func getVerticalChars(cl classifiedLine) (rune, rune) {
 	runes := []rune(cl.trimmed)
 	if len(runes) < 2 {
@@ -247,7 +777,9 @@ func getDividerChars(cl classifiedLine) borderChars {
 	return borderChars{'├', '┤', '─', '┼'}
 }
 
-func buildBorderLine(cl classifiedLine, contentWidth int) string {
+// buildBorderLine builds a single-column border with width horizontal
+// lines between its corners.
+func buildBorderLine(cl classifiedLine, width int) string {
 	runes := []rune(cl.trimmed)
 	if len(runes) < 2 {
 		return cl.trimmed
@@ -257,22 +789,43 @@ func buildBorderLine(cl classifiedLine, contentWidth int) string {
 	right := runes[len(runes)-1]
 	horiz := getHorizontalChar(cl)
 
-	return string(left) + strings.Repeat(string(horiz), contentWidth+2) + string(right)
+	return string(left) + strings.Repeat(string(horiz), width) + string(right)
 }
 
-func buildMultiColBorderLine(cl classifiedLine, maxWidths []int, chars borderChars) string {
+// buildSectionBorderLine builds a border between a section whose active
+// boundaries are above and one whose active boundaries are below. Either
+// may be nil for the top and bottom borders. Each column is pad wider than
+// its text.
+func buildSectionBorderLine(maxWidths []int, pad int, chars borderChars, above, below []bool) string {
 	var buf strings.Builder
 	buf.WriteRune(chars.left)
 	for c, w := range maxWidths {
-		buf.WriteString(strings.Repeat(string(chars.horizontal), w+2))
+		buf.WriteString(strings.Repeat(string(chars.horizontal), w+pad))
 		if c < len(maxWidths)-1 {
-			buf.WriteRune(chars.junction)
+			up := above != nil && above[c]
+			down := below != nil && below[c]
+			buf.WriteRune(junctionRune(chars, up, down))
 		}
 	}
 	buf.WriteRune(chars.right)
 	return buf.String()
 }
 
+func junctionRune(chars borderChars, up, down bool) rune {
+	switch {
+	case !up && !down:
+		return chars.horizontal
+	case chars.horizontal == '-':
+		return '+'
+	case up && down:
+		return '┼'
+	case up:
+		return '┴'
+	default:
+		return '┬'
+	}
+}
+
 func getHorizontalChar(cl classifiedLine) rune {
 	if cl.isASCII {
 		return '-'
@@ -280,7 +833,72 @@ func getHorizontalChar(cl classifiedLine) rune {
 	return '─'
 }
 
-func processFile(content string) string {
+// regionFix rewrites lines [startIdx, endIdx) of the input. apply returns
+// nil lines to leave them unchanged. widths, set for boxes only, returns
+// the content width of each column.
+type regionFix struct {
+	startIdx int
+	endIdx   int
+	apply    func(opts options) ([]string, error)
+	widths   func(opts options) []int
+}
+
+// maxLineWidth returns the display width of the widest of lines.
+func maxLineWidth(lines []string) int {
+	width := 0
+	for _, line := range lines {
+		width = max(width, stringWidth(line))
+	}
+	return width
+}
+
+// nonOverlapping sorts fixes by position and drops any fix that overlaps
+// an earlier one.
+func nonOverlapping(fixes []regionFix) []regionFix {
+	sort.SliceStable(fixes, func(i, j int) bool { return fixes[i].startIdx < fixes[j].startIdx })
+	result := fixes[:0]
+	end := 0
+	for _, f := range fixes {
+		if f.startIdx < end {
+			continue
+		}
+		result = append(result, f)
+		end = f.endIdx
+	}
+	return result
+}
+
+// splitLines splits content into lines with tabs expanded to tabWidth
+// columns and reports whether it ends with a newline.
+func splitLines(content string, tabWidth int) ([]string, bool) {
+	lines, hasTrailingNewline := splitRawLines(content)
+	return expandLines(lines, tabWidth), hasTrailingNewline
+}
+
+func expandLines(lines []string, tabWidth int) []string {
+	expanded := make([]string, len(lines))
+	for i, line := range lines {
+		expanded[i] = expandTabs(line, tabWidth)
+	}
+	return expanded
+}
+
+// splitRawLines splits content into lines as they are, apart from their
+// line endings and a byte order mark, and reports whether it ends with a
+// newline.
+func splitRawLines(content string) ([]string, bool) {
+	lines, _, hasTrailingNewline := splitLineEndings(content)
+	return lines, hasTrailingNewline
+}
+
+// byteOrderMark may start a UTF-8 file, and is not part of its first line.
+const byteOrderMark = "\ufeff"
+
+// splitLineEndings is like splitRawLines, but also returns the line ending
+// of each line, "\n" or "\r\n". The last line's is "\n" if it has none.
+func splitLineEndings(content string) ([]string, []string, bool) {
+	content = strings.TrimPrefix(content, byteOrderMark)
+
 	// Preserve trailing newline state
 	hasTrailingNewline := len(content) > 0 && content[len(content)-1] == '\n'
 
@@ -291,34 +909,185 @@ func processFile(content string) string {
 		lines = lines[:len(lines)-1]
 	}
 
-	// Expand tabs
+	ends := make([]string, len(lines))
 	for i, line := range lines {
-		lines[i] = expandTabs(line, 4)
+		ends[i] = "\n"
+		// A carriage return is only part of the line ending before a newline
+		if i < len(lines)-1 || hasTrailingNewline {
+			if trimmed, ok := strings.CutSuffix(line, "\r"); ok {
+				lines[i] = trimmed
+				ends[i] = "\r\n"
+			}
+		}
+	}
+	return lines, ends, hasTrailingNewline
+}
+
+func processFile(content string, opts options) (string, []diagnostic) {
+	var b strings.Builder
+	diags, err := formatStream(strings.NewReader(content), &b, opts)
+	if err != nil {
+		// Only invalid text fails, and it is left as it is
+		var d diagnostic
+		errors.As(err, &d)
+		return content, append(diags, d)
 	}
+	return b.String(), diags
+}
+
+// formatResult is the outcome of formatting a file. changed holds the
+// input lines of the regions whose formatting differs from the input.
+type formatResult struct {
+	text    string
+	diags   []diagnostic
+	changed []lineRange
+}
+
+func formatContent(content string, opts options) formatResult {
+	raw, ends, hasTrailingNewline := splitLineEndings(content)
+	lines := expandLines(raw, opts.tabWidth)
 
 	// Classify lines
 	classified := classifyLines(lines)
 
-	// Detect box regions
-	regions := detectBoxRegions(classified)
+	// Detect box regions and Markdown tables
+	regions := detectBoxRegions(classified, opts)
+	fixes := make([]regionFix, 0, len(regions))
+	for _, region := range regions {
+		fixes = append(fixes, regionFix{
+			startIdx: region.startIdx,
+			endIdx:   region.endIdx,
+			apply: func(opts options) ([]string, error) {
+				return fixBoxRegion(region, opts)
+			},
+			widths: func(opts options) []int {
+				return boxColumnWidths(region, opts)
+			},
+		})
+	}
+	for _, table := range detectMarkdownTables(lines) {
+		fixes = append(fixes, regionFix{
+			startIdx: table.startIdx,
+			endIdx:   table.endIdx,
+			apply:    table.toBox,
+		})
+	}
+	fixes = nonOverlapping(fixes)
 
-	// Apply fixes (process in reverse to preserve indices)
-	for i := len(regions) - 1; i >= 0; i-- {
-		region := regions[i]
-		fixed := fixBoxRegion(region)
+	// With tab indentation or a line restriction, lines that are not fixed
+	// keep their tabs
+	output := lines
+	if opts.indentTabs || opts.lines != nil {
+		output = raw
+	}
+
+	// Configure each fix with the directive before it, or before the code
+	// block it starts
+	blocks := codeBlocks(lines)
+	var diags []diagnostic
+	fixOpts := make([]options, len(fixes))
+	for i, f := range fixes {
+		fixOpts[i] = opts
+		at := f.startIdx
+		if b, ok := enclosingBlock(blocks, f.startIdx, f.endIdx); ok && allBlank(lines[b.start+1:f.startIdx]) {
+			at = b.start
+		}
+		if d, ok := directiveBefore(lines, at); ok {
+			o, err := d.apply(opts)
+			if err != nil {
+				if opts.lines == nil || overlapsAny(opts.lines, f.startIdx, f.endIdx) {
+					diags = append(diags, diagnostic{line: d.line, message: err.Error()})
+				}
+				continue
+			}
+			fixOpts[i] = o
+		}
+	}
+	uniformWidths(lines, fixes, fixOpts)
+
+	// Apply fixes, copying the lines between them as they are
+	var changed []lineRange
+	result := make([]string, 0, len(output))
+	resultEnds := make([]string, 0, len(output))
+	next := 0
+	for i, f := range fixes {
+		if opts.lines != nil && !overlapsAny(opts.lines, f.startIdx, f.endIdx) {
+			continue
+		}
+
+		fixOpts := fixOpts[i]
+		fixed, err := f.apply(fixOpts)
+		if err != nil {
+			var d diagnostic
+			if !errors.As(err, &d) {
+				d = diagnostic{line: f.startIdx, message: err.Error()}
+			}
+			diags = append(diags, d)
+			continue
+		}
+		if fixed == nil {
+			continue
+		}
 
-		// Replace lines in-place
-		newLines := make([]string, 0, len(lines)-region.endIdx+region.startIdx+len(fixed))
-		newLines = append(newLines, lines[:region.startIdx]...)
-		newLines = append(newLines, fixed...)
-		newLines = append(newLines, lines[region.endIdx:]...)
-		lines = newLines
+		// Boxes already drawn are wrapped to fit, so are only reported when
+		// they cannot be narrowed enough
+		if f.widths != nil && fixOpts.maxWidth > 0 && !isMarkdownTable(fixed) {
+			if w := maxLineWidth(fixed); w > fixOpts.maxWidth {
+				diags = append(diags, diagnostic{
+					line:    f.startIdx,
+					message: fmt.Sprintf("box is %d columns wide, more than the limit of %d", w, fixOpts.maxWidth),
+				})
+			}
+		}
+
+		// A table in a code block would not be rendered, so the block's
+		// fences go, unless it holds more than the box
+		if b, ok := enclosingBlock(blocks, f.startIdx, f.endIdx); ok && isMarkdownTable(fixed) {
+			if !b.holdsOnly(lines, f.startIdx, f.endIdx) {
+				diags = append(diags, diagnostic{
+					line:    f.startIdx,
+					message: "box shares a code block with other text and cannot become a Markdown table; box left unchanged",
+				})
+				continue
+			}
+			f.startIdx, f.endIdx = b.start, b.end
+		}
+
+		if fixOpts.indentTabs {
+			for j, line := range fixed {
+				fixed[j] = indentWithTabs(line, fixOpts.tabWidth)
+			}
+		}
+		if slices.Equal(fixed, output[f.startIdx:f.endIdx]) {
+			continue
+		}
+		changed = append(changed, lineRange{start: f.startIdx, end: f.endIdx})
+
+		result = append(result, output[next:f.startIdx]...)
+		resultEnds = append(resultEnds, ends[next:f.startIdx]...)
+		// The region's lines all end like its first line did
+		result = append(result, fixed...)
+		for range fixed {
+			resultEnds = append(resultEnds, ends[f.startIdx])
+		}
+		next = f.endIdx
 	}
+	result = append(result, output[next:]...)
+	resultEnds = append(resultEnds, ends[next:]...)
 
-	result := strings.Join(lines, "\n")
-	if hasTrailingNewline {
-		result += "\n"
+	var text strings.Builder
+	if strings.HasPrefix(content, byteOrderMark) {
+		text.WriteString(byteOrderMark)
+	}
+	for i, line := range result {
+		text.WriteString(line)
+		if i < len(result)-1 || hasTrailingNewline {
+			text.WriteString(resultEnds[i])
+		}
 	}
 
-	return result
+	// A directive's diagnostic comes before those of the region it is for
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].line < diags[j].line })
+
+	return formatResult{text: text.String(), diags: diags, changed: changed}
 }
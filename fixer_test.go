@@ -33,6 +33,13 @@ func TestSplitContentColumns(t *testing.T) {
 		{"│ a │ b │", 2, []string{"a", "b"}},
 		{"│ hello │ world │", 2, []string{"hello", "world"}},
 		{"| a | b | c |", 3, []string{"a", "b", "c"}},
+
+		// Escaped verticals and code spans are cell text
+		{`| a \| b | c |`, 2, []string{`a \| b`, "c"}},
+		{`│ a \│ b │ c │`, 2, []string{`a \│ b`, "c"}},
+		{"| `ls | wc` | c |", 2, []string{"`ls | wc`", "c"}},
+		{"| ``a ` | b`` | c |", 2, []string{"``a ` | b``", "c"}},
+		{"| `a | b |", 2, []string{"`a", "b"}},
 	}
 	for _, tt := range tests {
 		got := splitContentColumns(tt.input, tt.numCols)
@@ -56,7 +63,7 @@ func TestFixSingleColumnUnicode(t *testing.T) {
 		"└──────┘",
 	}, "\n")
 
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
 
 	// maxContentWidth should be 6 (日本語 = 6 display width)
@@ -86,7 +93,7 @@ func TestFixSingleColumnASCII(t *testing.T) {
 		"+------+",
 	}, "\n")
 
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
 
 	expectedBorder := "+--------+"
@@ -108,7 +115,7 @@ func TestFixMultiColumn(t *testing.T) {
 		"└──┴──┘",
 	}, "\n")
 
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
 
 	// Column 1: max width = 4 (日本), Column 2: max width = 2 (CD or B)
@@ -126,7 +133,7 @@ func TestFixPreservesIndent(t *testing.T) {
 		"  └──────┘",
 	}, "\n")
 
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
 
 	for _, line := range lines {
@@ -145,7 +152,7 @@ func TestFixWithDivider(t *testing.T) {
 		"└──────┘",
 	}, "\n")
 
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
 
 	expectedDivider := "├────────┤"
@@ -156,14 +163,14 @@ func TestFixWithDivider(t *testing.T) {
 
 func TestProcessFilePreservesPlainLines(t *testing.T) {
 	input := "hello\nworld\n"
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	if result != input {
 		t.Errorf("processFile(%q) = %q, want %q", input, result, input)
 	}
 }
 
 func TestProcessFileEmptyContent(t *testing.T) {
-	result := processFile("")
+	result, _ := processFile("", defaultOptions())
 	if result != "" {
 		t.Errorf("processFile(\"\") = %q, want \"\"", result)
 	}
@@ -171,14 +178,524 @@ func TestProcessFileEmptyContent(t *testing.T) {
 
 func TestPreserveTrailingNewline(t *testing.T) {
 	input := "┌──┐\n│ A│\n└──┘\n"
-	result := processFile(input)
+	result, _ := processFile(input, defaultOptions())
 	if result[len(result)-1] != '\n' {
 		t.Error("trailing newline not preserved")
 	}
 
 	input2 := "┌──┐\n│ A│\n└──┘"
-	result2 := processFile(input2)
+	result2, _ := processFile(input2, defaultOptions())
 	if result2[len(result2)-1] == '\n' {
 		t.Error("no-trailing-newline not preserved")
 	}
 }
+
+func TestPreserveLineEndings(t *testing.T) {
+	fromTable := defaultOptions()
+	fromTable.fromTable = true
+
+	tests := []struct {
+		name  string
+		input string
+		opts  options
+		want  string
+	}{
+		{
+			name:  "crlf",
+			input: "text\r\n┌─┐\r\n│ abc │\r\n└─┘\r\n",
+			opts:  defaultOptions(),
+			want:  "text\r\n┌─────┐\r\n│ abc │\r\n└─────┘\r\n",
+		},
+		{
+			name:  "crlf without trailing newline",
+			input: "┌─┐\r\n│ abc │\r\n└─┘",
+			opts:  defaultOptions(),
+			want:  "┌─────┐\r\n│ abc │\r\n└─────┘",
+		},
+		{
+			name:  "mixed",
+			input: "a\n┌─┐\r\n│ abc │\n└─┘\r\nb\r\n",
+			opts:  defaultOptions(),
+			want:  "a\n┌─────┐\r\n│ abc │\r\n└─────┘\r\nb\r\n",
+		},
+		{
+			name:  "table to box",
+			input: "| a | b |\r\n|---|---|\r\n| 1 | 2 |\r\n",
+			opts:  fromTable,
+			want:  "┌───┬───┐\r\n│ a │ b │\r\n├───┼───┤\r\n│ 1 │ 2 │\r\n└───┴───┘\r\n",
+		},
+		{
+			name:  "bom",
+			input: "\ufeff┌─┐\n│ abc │\n└─┘\n",
+			opts:  defaultOptions(),
+			want:  "\ufeff┌─────┐\n│ abc │\n└─────┘\n",
+		},
+		{
+			name:  "lone carriage return",
+			input: "a\rb\n",
+			opts:  defaultOptions(),
+			want:  "a\rb\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := processFile(tt.input, tt.opts); got != tt.want {
+				t.Errorf("processFile = %q, want %q", got, tt.want)
+			}
+			if got := formatContent(tt.input, tt.opts).text; got != tt.want {
+				t.Errorf("formatContent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCellPaddingAndMinimumWidth(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*options)
+		input     []string
+		want      []string
+	}{
+		{
+			name:      "padding",
+			configure: func(o *options) { o.padLeft, o.padRight = 2, 0 },
+			input:     []string{"┌─┐", "│ abc │", "└─┘"},
+			want:      []string{"┌─────┐", "│  abc│", "└─────┘"},
+		},
+		{
+			name:      "padding with columns",
+			configure: func(o *options) { o.padLeft, o.padRight = 0, 2 },
+			input:     []string{"┌─┬─┐", "│ a │ bb │", "├─┴─┤", "│ merged │", "└───┘"},
+			want:      []string{"┌───┬────┐", "│a  │bb  │", "├───┴────┤", "│merged  │", "└────────┘"},
+		},
+		{
+			name:      "wide padding is stable",
+			configure: func(o *options) { o.padLeft, o.padRight = 2, 2 },
+			input:     []string{"┌──────────────┐", "│  Title       │", "├─────┬────────┤", "│  a  │  bbbb  │", "└─────┴────────┘"},
+			want:      []string{"┌──────────────┐", "│  Title       │", "├─────┬────────┤", "│  a  │  bbbb  │", "└─────┴────────┘"},
+		},
+		{
+			name:      "wide padding to table",
+			configure: func(o *options) { o.padLeft, o.padRight, o.toTable = 2, 2, true },
+			input:     []string{"┌────────┬────────┐", "│  name  │  size  │", "├────────┼────────┤", "│  a     │    10  │", "└────────┴────────┘"},
+			want:      []string{"| name | size |", "| ---- | ---: |", "| a    |   10 |"},
+		},
+		{
+			name:      "minimum width",
+			configure: func(o *options) { o.minColumnWidth = 4 },
+			input:     []string{"┌─┬─┐", "│ a │ bbbbbb │", "└─┴─┘"},
+			want:      []string{"┌──────┬────────┐", "│ a    │ bbbbbb │", "└──────┴────────┘"},
+		},
+		{
+			name:      "minimum width single column",
+			configure: func(o *options) { o.minColumnWidth = 4 },
+			input:     []string{"┌─┐", "│ a │", "└─┘"},
+			want:      []string{"┌──────┐", "│ a    │", "└──────┘"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := defaultOptions()
+			tt.configure(&opts)
+			got, diags := processFile(strings.Join(tt.input, "\n"), opts)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestPaddingIsStable(t *testing.T) {
+	inputs := []string{
+		"┌─┐\n│ abc │\n│ a │\n└─┘",
+		"┌─┬─┐\n│ a │ bb │\n├─┴─┤\n│ merged │\n└───┘",
+	}
+	for _, pad := range [][2]int{{0, 0}, {0, 2}, {2, 0}, {2, 3}, {3, 1}} {
+		opts := defaultOptions()
+		opts.padLeft, opts.padRight = pad[0], pad[1]
+		for _, input := range inputs {
+			once, _ := processFile(input, opts)
+			if twice, _ := processFile(once, opts); twice != once {
+				t.Errorf("padding %v: formatting again changed\n%s\nto\n%s", pad, once, twice)
+			}
+		}
+	}
+}
+
+func TestPreserveIndent(t *testing.T) {
+	preserve := defaultOptions()
+	preserve.preserveIndent = true
+
+	tests := []struct {
+		name  string
+		opts  options
+		input []string
+		want  []string
+	}{
+		{
+			name:  "tree",
+			opts:  preserve,
+			input: []string{"┌─┐", "│ root │", "│   └─ child │", "│", "│     └─ leaf   │", "└─┘"},
+			want:  []string{"┌─────────────┐", "│ root        │", "│   └─ child  │", "│             │", "│     └─ leaf │", "└─────────────┘"},
+		},
+		{
+			name:  "shared indentation",
+			opts:  preserve,
+			input: []string{"┌─┐", "│   a  │", "│     b │", "└─┘"},
+			want:  []string{"┌─────┐", "│ a   │", "│   b │", "└─────┘"},
+		},
+		{
+			name:  "columns",
+			opts:  preserve,
+			input: []string{"┌─┬─┐", "│ name     │ size │", "│   - a    │ 10 │", "│     - b  │ 200 │", "└─┴─┘"},
+			want: []string{
+				"┌─────────┬──────┐",
+				"│ name    │ size │",
+				"│   - a   │ 10   │",
+				"│     - b │ 200  │",
+				"└─────────┴──────┘",
+			},
+		},
+		{
+			name:  "tight columns",
+			opts:  preserve,
+			input: []string{"┌─┬─┐", "│ a │ root │", "│ b │   └─ child │", "└─┴─┘"},
+			want:  []string{"┌───┬────────────┐", "│ a │ root       │", "│ b │   └─ child │", "└───┴────────────┘"},
+		},
+		{
+			name:  "right-aligned numbers",
+			opts:  preserve,
+			input: []string{"┌─┬─┐", "│ a │    1 │", "│ b │ 1234 │", "└─┴─┘"},
+			want:  []string{"┌───┬──────┐", "│ a │    1 │", "│ b │ 1234 │", "└───┴──────┘"},
+		},
+		{
+			name:  "off",
+			opts:  defaultOptions(),
+			input: []string{"┌─┬─┐", "│ name │ size │", "│   - a  │ 10 │", "└─┴─┘"},
+			want:  []string{"┌──────┬──────┐", "│ name │ size │", "│ - a  │ 10   │", "└──────┴──────┘"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, diags := processFile(strings.Join(tt.input, "\n"), tt.opts)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRepairBrokenBoxes(t *testing.T) {
+	repair := defaultOptions()
+	repair.repair = true
+
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			"missing right edge",
+			[]string{"┌──────┐", "│ hi", "│ 日本語 │", "└──────┘"},
+			[]string{"┌────────┐", "│ hi     │", "│ 日本語 │", "└────────┘"},
+		},
+		{
+			"missing bottom border",
+			[]string{"┌──┬──┐", "│ A│ B│", "│ CD│ E│"},
+			[]string{"┌────┬───┐", "│ A  │ B │", "│ CD │ E │", "└────┴───┘"},
+		},
+		{
+			"missing top border",
+			[]string{"│ A│ BC│", "└──┴──┘"},
+			[]string{"┌───┬────┐", "│ A │ BC │", "└───┴────┘"},
+		},
+		{
+			"ascii missing bottom border",
+			[]string{"+--+", "| hello |", "+--+", "| x |"},
+			[]string{"+-------+", "| hello |", "+-------+", "| x     |", "+-------+"},
+		},
+		{
+			"short open divider",
+			[]string{"┌──┐", "│ hello │", "├─", "│ x │", "└──┘"},
+			[]string{"┌───────┐", "│ hello │", "├───────┤", "│ x     │", "└───────┘"},
+		},
+	}
+	for _, tt := range tests {
+		result, _ := processFile(strings.Join(tt.input, "\n"), repair)
+		want := strings.Join(tt.want, "\n")
+		if result != want {
+			t.Errorf("%s:\n--- got ---\n%s\n--- want ---\n%s", tt.name, result, want)
+		}
+	}
+}
+
+func TestRepairDisabledByDefault(t *testing.T) {
+	input := "┌──┐\n│ A\n└──┘\n"
+	result, _ := processFile(input, defaultOptions())
+	if result != input {
+		t.Errorf("processFile(%q) = %q, want unchanged", input, result)
+	}
+}
+
+func TestFixMergedCells(t *testing.T) {
+	input := strings.Join([]string{
+		"┌──┬──┐",
+		"│ A│ B│",
+		"├──┴──┤",
+		"│ merged across both │",
+		"├──┬──┤",
+		"│ C│ D│",
+		"└──┴──┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"┌───┬────────────────┐",
+		"│ A │ B              │",
+		"├───┴────────────────┤",
+		"│ merged across both │",
+		"├───┬────────────────┤",
+		"│ C │ D              │",
+		"└───┴────────────────┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixMergedCellsPartial(t *testing.T) {
+	input := strings.Join([]string{
+		"┌─┬─┬─┐",
+		"│ a│ b│ c│",
+		"├─┴─┼─┤",
+		"│ ab│ c│",
+		"└───┴─┘",
+	}, "\n")
+	want := strings.Join([]string{
+		"┌───┬───┬───┐",
+		"│ a │ b │ c │",
+		"├───┴───┼───┤",
+		"│ ab    │ c │",
+		"└───────┴───┘",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixColumnCountMismatch(t *testing.T) {
+	extra := strings.Join([]string{
+		"┌──┬──┐",
+		"│ A│ B│",
+		"│ C│ D│ E│",
+		"└──┴──┘",
+	}, "\n")
+	result, diags := processFile(extra, defaultOptions())
+	if result != extra {
+		t.Errorf("box with extra cells was modified:\n%s", result)
+	}
+	if len(diags) != 1 || diags[0].line != 2 {
+		t.Fatalf("diagnostics = %v, want one on line index 2", diags)
+	}
+
+	missing := strings.Join([]string{
+		"┌──┬──┐",
+		"│ A│ B│",
+		"│ C │",
+		"│   │",
+		"└──┴──┘",
+	}, "\n")
+	result, diags = processFile(missing, defaultOptions())
+	if result != missing {
+		t.Errorf("box with missing cells was modified:\n%s", result)
+	}
+	if len(diags) != 1 || diags[0].line != 2 {
+		t.Fatalf("diagnostics = %v, want one on line index 2", diags)
+	}
+
+	pad := defaultOptions()
+	pad.padCells = true
+	want := strings.Join([]string{
+		"┌───┬───┐",
+		"│ A │ B │",
+		"│ C │   │",
+		"│   │   │",
+		"└───┴───┘",
+	}, "\n")
+	result, diags = processFile(missing, pad)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestFixPreservesEscapedPipes(t *testing.T) {
+	input := strings.Join([]string{
+		"+---+---+",
+		`| cmd | a \| b |`,
+		"| `ls | wc -l` | 日本 |",
+		"+---+---+",
+	}, "\n")
+	want := strings.Join([]string{
+		"+--------------+--------+",
+		`| cmd          | a \| b |`,
+		"| `ls | wc -l` | 日本   |",
+		"+--------------+--------+",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+
+	again, _ := processFile(result, defaultOptions())
+	if again != result {
+		t.Errorf("formatting is not idempotent:\n%s", again)
+	}
+}
+
+func TestInferAlignments(t *testing.T) {
+	input := strings.Join([]string{
+		"┌──────┬─────┬────┬────┐",
+		"│ left │ ctr │ rt │ x  │",
+		"│ a    │  b  │  c │ y  │",
+		"│ dd   │ ee  │ ff │ zz │",
+		"└──────┴─────┴────┴────┘",
+	}, "\n")
+	region := detectBoxRegions(classifyLines(strings.Split(input, "\n")), defaultOptions())[0]
+	table, err := parseBoxTable(region, detectColumns(region), defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []alignment{alignDefault, alignCenter, alignRight, alignDefault}
+	for i := range want {
+		if table.align[i] != want[i] {
+			t.Errorf("column %d alignment = %v, want %v", i, table.align[i], want[i])
+		}
+	}
+
+	result, _ := processFile(input, defaultOptions())
+	if result != input {
+		t.Errorf("aligned box was reformatted:\n%s", result)
+	}
+}
+
+func TestInferAlignmentsMisaligned(t *testing.T) {
+	input := strings.Join([]string{"┌─────┬────────┐", "│ key │ - item │", "│     │   - sub │", "└─────┴────────┘"}, "\n")
+	want := strings.Join([]string{"┌─────┬────────┐", "│ key │ - item │", "│     │ - sub  │", "└─────┴────────┘"}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestMaxWidthWrapsBoxes(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxWidth int
+		input    []string
+		want     []string
+	}{
+		{
+			name:     "single column",
+			maxWidth: 10,
+			input:    []string{"text", "┌─┐", "│ much too wide │", "│ ok │", "└─┘"},
+			want:     []string{"text", "┌──────┐", "│ much │", "│ too  │", "│ wide │", "│ ok   │", "└──────┘"},
+		},
+		{
+			name:     "indented",
+			maxWidth: 12,
+			input:    []string{"  ┌─┐", "  │ much too wide │", "  └─┘"},
+			want:     []string{"  ┌──────┐", "  │ much │", "  │ too  │", "  │ wide │", "  └──────┘"},
+		},
+		{
+			// Each line is a row, so the rows are set apart
+			name:     "rows",
+			maxWidth: 16,
+			input:    []string{"┌─┬─┐", "│ key │ value │", "├─┼─┤", "│ a │ one two three │", "│ b │ four │", "└─┴─┘"},
+			want: []string{
+				"┌─────┬───────┐", "│ key │ value │", "├─────┼───────┤",
+				"│ a   │ one   │", "│     │ two   │", "│     │ three │", "├─────┼───────┤",
+				"│ b   │ four  │", "└─────┴───────┘",
+			},
+		},
+		{
+			// Each section is a row, so only its lines grow
+			name:     "sections",
+			maxWidth: 16,
+			input:    []string{"┌─┬─┐", "│ key │ value │", "├─┼─┤", "│ a │ one two three │", "├─┼─┤", "│ b │ four │", "└─┴─┘"},
+			want: []string{
+				"┌─────┬───────┐", "│ key │ value │", "├─────┼───────┤",
+				"│ a   │ one   │", "│     │ two   │", "│     │ three │", "├─────┼───────┤",
+				"│ b   │ four  │", "└─────┴───────┘",
+			},
+		},
+		{
+			name:     "merged cell",
+			maxWidth: 14,
+			input:    []string{"┌─┬─┐", "│ a │ b │", "├─┴─┤", "│ a merged cell │", "└───┘"},
+			want:     []string{"┌───┬──────┐", "│ a │ b    │", "├───┴──────┤", "│ a merged │", "│ cell     │", "└──────────┘"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := defaultOptions()
+			opts.maxWidth = tt.maxWidth
+			result, diags := processFile(strings.Join(tt.input, "\n"), opts)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if want := strings.Join(tt.want, "\n"); result != want {
+				t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+			}
+			if again, _ := processFile(result, opts); again != result {
+				t.Errorf("wrapped box is not stable:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestMaxWidthReportsWideBoxes(t *testing.T) {
+	opts := defaultOptions()
+	opts.maxWidth = 8
+
+	// Columns are not narrowed below one character
+	input := strings.Join([]string{"text", "┌─┬─┬─┐", "│ a │ b │ c │", "└─┴─┴─┘"}, "\n")
+	want := strings.Join([]string{"text", "┌───┬───┬───┐", "│ a │ b │ c │", "└───┴───┴───┘"}, "\n")
+	result, diags := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+	if len(diags) != 1 || diags[0].line != 1 {
+		t.Errorf("diagnostics = %v, want one on line index 1", diags)
+	}
+
+	opts.maxWidth = 13
+	if _, diags := processFile(input, opts); len(diags) != 0 {
+		t.Errorf("unexpected diagnostics: %v", diags)
+	}
+}
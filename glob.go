@@ -0,0 +1,81 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// compileGlob compiles a file glob into a regular expression matching
+// slash-separated paths relative to the directory the glob was written in.
+//
+// "*" and "?" do not match "/", "**" matches any number of directories, and
+// "{a,b}" matches either alternative. A glob without a slash matches a file
+// name at any depth, and a glob matching a directory also matches every
+// path below it.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	return regexp.Compile(globToRegexp(glob) + "(?:/.*)?$")
+}
+
+// compileExactGlob is like compileGlob, but a glob matching a directory does
+// not match the paths below it.
+func compileExactGlob(glob string) (*regexp.Regexp, error) {
+	return regexp.Compile(globToRegexp(glob) + "$")
+}
+
+func globToRegexp(glob string) string {
+	var buf strings.Builder
+	buf.WriteString("^")
+	if !strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+		buf.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	glob = strings.TrimSuffix(glob, "/")
+
+	runes := []rune(glob)
+	braces := 0
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '*' && i+1 < len(runes) && runes[i+1] == '*':
+			i++
+			if i+1 < len(runes) && runes[i+1] == '/' {
+				// "**/" also matches no directory at all
+				i++
+				buf.WriteString("(?:.*/)?")
+			} else {
+				buf.WriteString(".*")
+			}
+		case r == '*':
+			buf.WriteString("[^/]*")
+		case r == '?':
+			buf.WriteString("[^/]")
+		case r == '[':
+			end := slices.Index(runes[i+1:], ']')
+			if end < 0 {
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := string(runes[i+1 : i+1+end])
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			buf.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case r == '{':
+			braces++
+			buf.WriteString("(?:")
+		case r == '}' && braces > 0:
+			braces--
+			buf.WriteString(")")
+		case r == ',' && braces > 0:
+			buf.WriteString("|")
+		case r == '\\' && i+1 < len(runes):
+			i++
+			buf.WriteString(regexp.QuoteMeta(string(runes[i])))
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		path string
+		want bool
+	}{
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "README.txt", false},
+		{"docs/*.md", "docs/intro.md", true},
+		{"docs/*.md", "docs/guide/intro.md", false},
+		{"docs/*.md", "other/docs/intro.md", false},
+		{"docs/**/*.md", "docs/intro.md", true},
+		{"docs/**/*.md", "docs/a/b/intro.md", true},
+		{"/README.md", "README.md", true},
+		{"/README.md", "docs/README.md", false},
+		{"vendor", "vendor/pkg/README.md", true},
+		{"vendor/", "a/vendor/README.md", true},
+		{"*.{md,txt}", "notes.txt", true},
+		{"*.{md,txt}", "notes.rst", false},
+		{"file?.md", "file1.md", true},
+		{"file[0-9].md", "file7.md", true},
+		{"file[!0-9].md", "file7.md", false},
+		{"a.b", "axb", false},
+	}
+
+	for _, tt := range tests {
+		re, err := compileGlob(tt.glob)
+		if err != nil {
+			t.Fatalf("compileGlob(%q): %v", tt.glob, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("compileGlob(%q).MatchString(%q) = %v, want %v", tt.glob, tt.path, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,14 @@ module github.com/HMasataka/claude/boxfmt
 go 1.23.0
 
 require (
-	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/mattn/go-runewidth v0.0.16
+	golang.org/x/text v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/rivo/uniseg v0.2.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
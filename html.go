@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// boxToHTML converts a box into an HTML block for Markdown documents.
+// Multi-column boxes become a <table> with colspan for merged cells and a
+// <thead> for the rows above the first divider; other boxes are formatted
+// and wrapped in <pre>. HTML blocks are not indented, since indentation
+// would turn them into code blocks or leak into the <pre> text.
+func boxToHTML(region boxRegion, opts options) ([]string, error) {
+	layout := detectColumns(region)
+	if len(layout.separators) == 0 {
+		lines := []string{`<pre class="boxfmt">`}
+		for _, line := range fixSingleColumnBox(region, opts) {
+			lines = append(lines, html.EscapeString(strings.TrimPrefix(line, region.indent)))
+		}
+		lines[len(lines)-1] += "</pre>"
+		return lines, nil
+	}
+
+	table, err := parseBoxTable(region, layout, opts)
+	if err != nil {
+		return nil, err
+	}
+	return renderHTMLTable(region, table), nil
+}
+
+// renderHTMLTable renders a parsed multi-column box as a bordered table.
+// Like Markdown tables, body sections separated by dividers become one row
+// each, with the lines of each cell joined by <br>.
+func renderHTMLTable(region boxRegion, table boxTable) []string {
+	sections := table.sections(region)
+
+	var head [][]cell
+	body := sections
+	if len(sections) >= 2 {
+		head = sections[0]
+		body = sections[1:]
+	}
+
+	var bodyRows [][][]cell
+	if len(body) == 1 {
+		for _, row := range body[0] {
+			bodyRows = append(bodyRows, [][]cell{row})
+		}
+	} else {
+		bodyRows = body
+	}
+
+	lines := []string{`<table class="boxfmt" style="border-collapse: collapse">`}
+	if head != nil {
+		lines = append(lines, "<thead>", htmlRow(head, "th", table.align), "</thead>")
+	}
+	lines = append(lines, "<tbody>")
+	for _, rows := range bodyRows {
+		lines = append(lines, htmlRow(rows, "td", table.align))
+	}
+	lines = append(lines, "</tbody>", "</table>")
+	return lines
+}
+
+// htmlRow renders the lines of one section as a single table row. All
+// lines of a section share the same cells, so they are joined cell by cell.
+func htmlRow(rows [][]cell, tag string, aligns []alignment) string {
+	var b strings.Builder
+	b.WriteString("<tr>")
+	for j, c := range rows[0] {
+		var texts []string
+		for _, row := range rows {
+			if j < len(row) && row[j].text != "" {
+				texts = append(texts, html.EscapeString(unescapeCellText(row[j].text)))
+			}
+		}
+
+		style := "border: 1px solid; padding: 0.25em 0.5em"
+		switch aligns[c.col] {
+		case alignCenter:
+			style += "; text-align: center"
+		case alignRight:
+			style += "; text-align: right"
+		}
+
+		fmt.Fprintf(&b, "<%s", tag)
+		if c.span > 1 {
+			fmt.Fprintf(&b, ` colspan="%d"`, c.span)
+		}
+		fmt.Fprintf(&b, ` style="%s">%s</%s>`, style, strings.Join(texts, "<br>"), tag)
+	}
+	b.WriteString("</tr>")
+	return b.String()
+}
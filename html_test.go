@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBoxToHTMLTable(t *testing.T) {
+	input := strings.Join([]string{
+		"  ┌──┬──┐",
+		"  │ Name│ Value │",
+		"  ├──┼──┤",
+		"  │ a │ 1 < 2 │",
+		"  │ b │ x \\| y │",
+		"  ├──┴──┤",
+		"  │ merged │",
+		"  └─────┘",
+	}, "\n")
+
+	opts := defaultOptions()
+	opts.toHTML = true
+	result, diags := processFile(input, opts)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+
+	for _, want := range []string{
+		`<table class="boxfmt" style="border-collapse: collapse">`,
+		`<thead>` + "\n" + `<tr><th style="border: 1px solid; padding: 0.25em 0.5em">Name</th>`,
+		`<td style="border: 1px solid; padding: 0.25em 0.5em">a<br>b</td>`,
+		`1 &lt; 2<br>x | y`,
+		`<td colspan="2" style="border: 1px solid; padding: 0.25em 0.5em">merged</td>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("output lacks %q:\n%s", want, result)
+		}
+	}
+	if strings.HasPrefix(result, " ") {
+		t.Errorf("HTML block is indented:\n%s", result)
+	}
+}
+
+func TestBoxToHTMLPre(t *testing.T) {
+	input := "┌──┐\n│ a<b │\n└──┘\n"
+	want := "<pre class=\"boxfmt\">\n┌─────┐\n│ a&lt;b │\n└─────┘</pre>\n"
+
+	opts := defaultOptions()
+	opts.toHTML = true
+	result, _ := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
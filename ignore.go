@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreNames are the ignore files read in each directory, from lowest to
+// highest precedence.
+var ignoreNames = []string{".gitignore", ".boxfmtignore"}
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFile holds the rules of a .gitignore or .boxfmtignore file, which
+// are relative to dir.
+type ignoreFile struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// loadIgnoreFile parses the ignore file at path with gitignore semantics,
+// or returns nil if it does not exist.
+func loadIgnoreFile(path string) (*ignoreFile, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ignore := &ignoreFile{dir: filepath.Dir(path)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreRule(scanner.Text()); ok {
+			ignore.rules = append(ignore.rules, rule)
+		}
+	}
+	return ignore, scanner.Err()
+}
+
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	// Trailing spaces are ignored unless escaped
+	trimmed := strings.TrimRight(line, " ")
+	if strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+		trimmed += " "
+	}
+	line = trimmed
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	re, err := compileExactGlob(line)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.pattern = re
+	return rule, true
+}
+
+// match reports whether the file's rules ignore path, and whether any of
+// them matched it at all. The last matching rule wins. As in git, a rule
+// does not match the paths below a directory it matches; those are skipped
+// by not walking into the directory.
+func (f *ignoreFile) match(path string, isDir bool) (ignored, matched bool) {
+	rel, err := filepath.Rel(f.dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		rule := f.rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.pattern.MatchString(rel) {
+			return !rule.negate, true
+		}
+	}
+	return false, false
+}
+
+// ignoreStack is the ignore files that apply within a directory, from
+// the outermost to the innermost.
+type ignoreStack []*ignoreFile
+
+// ignored reports whether path is ignored. Files deeper in the tree take
+// precedence over those above them.
+func (s ignoreStack) ignored(path string, isDir bool) bool {
+	for i := len(s) - 1; i >= 0; i-- {
+		if ignored, matched := s[i].match(path, isDir); matched {
+			return ignored
+		}
+	}
+	return false
+}
+
+// push returns the stack with the ignore files in dir added.
+func (s ignoreStack) push(dir string) (ignoreStack, error) {
+	for _, name := range ignoreNames {
+		f, err := loadIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			return s, err
+		}
+		if f != nil {
+			// Copy so sibling directories do not share the appended files
+			s = append(s[:len(s):len(s)], f)
+		}
+	}
+	return s, nil
+}
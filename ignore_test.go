@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreFileMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".gitignore"), `# generated
+*.gen.md
+!keep.gen.md
+build/
+/TODO.md
+docs/api
+trailing\ 
+`)
+	f, err := loadIgnoreFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+		matched bool
+	}{
+		{"a/b/x.gen.md", false, true, true},
+		{"keep.gen.md", false, false, true},
+		{"build", true, true, true},
+		{"build", false, false, false},
+		{"src/build", true, true, true},
+		{"TODO.md", false, true, true},
+		{"sub/TODO.md", false, false, false},
+		{"docs/api", true, true, true},
+		{"docs/api/ref.md", false, false, false},
+		{"other/docs/api", true, false, false},
+		{"trailing ", false, true, true},
+		{"README.md", false, false, false},
+	}
+
+	for _, tt := range tests {
+		ignored, matched := f.match(filepath.Join(dir, tt.path), tt.isDir)
+		if ignored != tt.ignored || matched != tt.matched {
+			t.Errorf("match(%q, %v) = %v, %v; want %v, %v", tt.path, tt.isDir, ignored, matched, tt.ignored, tt.matched)
+		}
+	}
+}
+
+func TestIgnoreStackPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".gitignore"), "*.md\n")
+	writeFile(t, filepath.Join(dir, "docs", ".boxfmtignore"), "!guide.md\n")
+
+	stack, err := ignoreStack(nil).push(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err = stack.push(filepath.Join(dir, "docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !stack.ignored(filepath.Join(dir, "docs", "intro.md"), false) {
+		t.Error("docs/intro.md not ignored")
+	}
+	if stack.ignored(filepath.Join(dir, "docs", "guide.md"), false) {
+		t.Error("docs/guide.md ignored despite the negation in docs/.boxfmtignore")
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// journalRuns is the number of runs kept in the journal.
+const journalRuns = 10
+
+// journalName is the file in a run's directory listing the files it
+// rewrote, one JSON journalEntry per line.
+const journalName = "journal.jsonl"
+
+// journalDir returns the directory holding the journals of past runs.
+func journalDir() (string, error) {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cache, "boxfmt", "journal"), nil
+}
+
+// journal saves the originals of the files a run overwrites, so that
+// `boxfmt undo` can restore them. Each run has its own directory under
+// root, named so that they sort by time, which is created with the first
+// file saved. Failures are reported to errOut.
+type journal struct {
+	root   string
+	now    func() time.Time
+	errOut io.Writer
+
+	mu      sync.Mutex
+	dir     string
+	entries int
+	failed  bool
+}
+
+// journalEntry records a file rewritten by a run: its absolute path, the
+// name of the copy of its original, and the SHA-256 sum of what was
+// written in its place.
+type journalEntry struct {
+	Path string `json:"path"`
+	Copy string `json:"copy"`
+	Sum  string `json:"sum"`
+}
+
+func newJournal(root string) *journal {
+	return &journal{root: root, now: time.Now, errOut: os.Stderr}
+}
+
+// record saves a copy of the file at path, which is about to be replaced by
+// content with the given sum. A failure only means that the run cannot be
+// undone, so it is reported once and the journal is not used again.
+func (j *journal) record(path string, sum []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.failed {
+		return
+	}
+	if err := j.save(path, sum); err != nil {
+		j.failed = true
+		fmt.Fprintf(j.errOut, "warning: %v; this run cannot be undone\n", err)
+	}
+}
+
+// save is record without the error handling, called with mu held.
+func (j *journal) save(path string, sum []byte) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	if j.dir == "" {
+		if err := os.MkdirAll(j.root, 0700); err != nil {
+			return err
+		}
+		pruneJournal(j.root, journalRuns-1)
+		dir, err := os.MkdirTemp(j.root, j.now().UTC().Format("20060102T150405.000000000")+"-")
+		if err != nil {
+			return err
+		}
+		j.dir = dir
+	}
+
+	entry := journalEntry{Path: abs, Copy: strconv.Itoa(j.entries), Sum: fmt.Sprintf("%x", sum)}
+	if err := copyFile(path, filepath.Join(j.dir, entry.Copy)); err != nil {
+		return err
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(j.dir, journalName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	j.entries++
+	return err
+}
+
+// journalRunDirs returns the run directories under root from oldest to
+// newest.
+func journalRunDirs(root string) ([]string, error) {
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, filepath.Join(root, e.Name()))
+		}
+	}
+	slices.Sort(dirs)
+	return dirs, nil
+}
+
+// pruneJournal removes all but the newest keep runs under root.
+func pruneJournal(root string, keep int) {
+	dirs, _ := journalRunDirs(root)
+	for len(dirs) > keep {
+		os.RemoveAll(dirs[0])
+		dirs = dirs[1:]
+	}
+}
+
+func runUndo(args []string) int {
+	fs := flag.NewFlagSet("undo", flag.ContinueOnError)
+	force := fs.Bool("force", false, "restore files even if they changed after formatting")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: boxfmt undo [options]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	root, err := journalDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err := undo(root, *force, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// undo restores the files rewritten by the newest run in the journal under
+// root, printing the path of each to out, and removes the run. Files that
+// changed since they were formatted are left alone unless force is set,
+// and the run is then kept so they can be restored later.
+func undo(root string, force bool, out, errOut io.Writer) error {
+	dirs, err := journalRunDirs(root)
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return errors.New("nothing to undo")
+	}
+	dir := dirs[len(dirs)-1]
+	entries, err := readJournal(filepath.Join(dir, journalName))
+	if err != nil {
+		return err
+	}
+
+	var failed []journalEntry
+	for _, e := range slices.Backward(entries) {
+		if err := restoreEntry(dir, e, force); err != nil {
+			fmt.Fprintf(errOut, "error: %v\n", err)
+			failed = append(failed, e)
+			continue
+		}
+		fmt.Fprintln(out, e.Path)
+	}
+	if len(failed) > 0 {
+		// Keep only the files still to restore
+		slices.Reverse(failed)
+		if err := writeJournal(filepath.Join(dir, journalName), failed); err != nil {
+			return err
+		}
+		return fmt.Errorf("%d of %d files could not be restored", len(failed), len(entries))
+	}
+	return os.RemoveAll(dir)
+}
+
+func readJournal(path string) ([]journalEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []journalEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+func writeJournal(path string, entries []journalEntry) error {
+	var b []byte
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+	return os.WriteFile(path, b, 0600)
+}
+
+// restoreEntry writes the saved original of a journal entry back.
+func restoreEntry(dir string, e journalEntry, force bool) error {
+	target, err := filepath.EvalSymlinks(e.Path)
+	if err != nil {
+		return err
+	}
+	if !force {
+		sum, err := fileSum(target)
+		if err != nil {
+			return err
+		}
+		if fmt.Sprintf("%x", sum) != e.Sum {
+			return fmt.Errorf("%s changed after it was formatted; use -force to restore it anyway", e.Path)
+		}
+	}
+
+	saved, err := os.Open(filepath.Join(dir, e.Copy))
+	if err != nil {
+		return err
+	}
+	defer saved.Close()
+	return writeAtomic(target, func(w io.Writer) (bool, error) {
+		_, err := io.Copy(w, saved)
+		return err == nil, err
+	})
+}
+
+func fileSum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUndo(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "journal")
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.md")
+	b := filepath.Join(dir, "b.md")
+	writeFile(t, a, "┌─┐\n│ a1 │\n└─┘\n")
+	writeFile(t, b, "┌─┐\n│ b1 │\n└─┘\n")
+
+	j := newJournal(root)
+	keep := keepOriginal("", j)
+	for _, path := range []string{a, b} {
+		if _, _, err := replaceFile(path, defaultOptions(), keep); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out, errOut bytes.Buffer
+	if err := undo(root, false, &out, &errOut); err != nil {
+		t.Fatalf("undo: %v\n%s", err, errOut.String())
+	}
+	for path, want := range map[string]string{a: "┌─┐\n│ a1 │\n└─┘\n", b: "┌─┐\n│ b1 │\n└─┘\n"} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", path, data, want)
+		}
+	}
+	if got, want := out.String(), b+"\n"+a+"\n"; got != want {
+		t.Errorf("output %q, want %q", got, want)
+	}
+
+	if err := undo(root, false, &out, &errOut); err == nil || !strings.Contains(err.Error(), "nothing to undo") {
+		t.Errorf("second undo: %v, want nothing to undo", err)
+	}
+}
+
+func TestUndoChangedFile(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(t.TempDir(), "a.md")
+	writeFile(t, path, "┌─┐\n│ a │\n└─┘\n")
+	if _, _, err := replaceFile(path, defaultOptions(), keepOriginal("", newJournal(root))); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "edited\n")
+
+	var out, errOut bytes.Buffer
+	if err := undo(root, false, &out, &errOut); err == nil {
+		t.Fatal("undo restored a file changed after formatting")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "edited\n" {
+		t.Errorf("changed file was overwritten:\n%s", data)
+	}
+
+	if err := undo(root, true, &out, &errOut); err != nil {
+		t.Fatalf("undo -force: %v\n%s", err, errOut.String())
+	}
+	if data, _ := os.ReadFile(path); string(data) != "┌─┐\n│ a │\n└─┘\n" {
+		t.Errorf("not restored:\n%s", data)
+	}
+}
+
+func TestJournalFailure(t *testing.T) {
+	dir := t.TempDir()
+	// The journal cannot be created below a regular file
+	blocker := filepath.Join(dir, "cache")
+	writeFile(t, blocker, "")
+	j := newJournal(filepath.Join(blocker, "journal"))
+	var errOut bytes.Buffer
+	j.errOut = &errOut
+
+	keep := keepOriginal("", j)
+	for _, name := range []string{"a.md", "b.md"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, "┌─┐\n│ a │\n└─┘\n")
+		if _, _, err := replaceFile(path, defaultOptions(), keep); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "┌───┐\n│ a │\n└───┘\n" {
+			t.Errorf("%s not formatted:\n%s", name, data)
+		}
+	}
+	if n := strings.Count(errOut.String(), "warning:"); n != 1 {
+		t.Errorf("%d warnings, want 1:\n%s", n, errOut.String())
+	}
+}
+
+func TestUndoNewestRun(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(t.TempDir(), "a.md")
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Each run formats a different version of the file
+	for i := range journalRuns + 2 {
+		writeFile(t, path, fmt.Sprintf("┌─┐\n│ run %d │\n└─┘\n", i))
+		j := newJournal(root)
+		j.now = func() time.Time { return start.Add(time.Duration(i) * time.Minute) }
+		if _, _, err := replaceFile(path, defaultOptions(), keepOriginal("", j)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dirs, err := journalRunDirs(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) != journalRuns {
+		t.Errorf("%d runs kept, want %d", len(dirs), journalRuns)
+	}
+
+	var out, errOut bytes.Buffer
+	if err := undo(root, false, &out, &errOut); err != nil {
+		t.Fatalf("undo: %v\n%s", err, errOut.String())
+	}
+	want := fmt.Sprintf("┌─┐\n│ run %d │\n└─┘\n", journalRuns+1)
+	if data, _ := os.ReadFile(path); string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
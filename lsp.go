@@ -0,0 +1,513 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// JSON-RPC error codes used by the server.
+const (
+	rpcParseError     = -32700
+	rpcInvalidParams  = -32602
+	rpcMethodNotFound = -32601
+	rpcInvalidRequest = -32600
+)
+
+// LSP diagnostic severities.
+const (
+	severityWarning     = 2
+	severityInformation = 3
+)
+
+type rpcRequest struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcNotification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// lspPosition is a position with the character offset in UTF-16 code
+// units, the LSP default.
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspDiagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type lspCodeAction struct {
+	Title string           `json:"title"`
+	Kind  string           `json:"kind"`
+	Edit  lspWorkspaceEdit `json:"edit"`
+}
+
+type lspWorkspaceEdit struct {
+	Changes map[string][]lspTextEdit `json:"changes"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// lspServer formats and lints the documents an editor has open. It serves
+// one request at a time, so document state needs no locking.
+type lspServer struct {
+	in       *bufio.Reader
+	out      io.Writer
+	docs     map[string]string
+	resolver *optionResolver
+	shutdown bool
+}
+
+// runLSP implements the lsp subcommand, which speaks the Language Server
+// Protocol over stdin and stdout.
+func runLSP(args []string) int {
+	fs := flag.NewFlagSet("lsp", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: boxfmt lsp")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	s := newLSPServer(os.Stdin, os.Stdout)
+	if err := s.serve(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if !s.shutdown {
+		// Exit without a shutdown request, as the protocol requires
+		return 1
+	}
+	return 0
+}
+
+func newLSPServer(in io.Reader, out io.Writer) *lspServer {
+	return &lspServer{
+		in:       bufio.NewReader(in),
+		out:      out,
+		docs:     make(map[string]string),
+		resolver: newOptionResolver(nil),
+	}
+}
+
+// serve handles messages until the exit notification or the end of input.
+func (s *lspServer) serve() error {
+	for {
+		data, err := readMessage(s.in)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			if err := s.reply(nil, nil, &rpcError{Code: rpcParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(req)
+		if req.ID == nil {
+			// Notifications get no response, even on error
+			continue
+		}
+		var rpcErr *rpcError
+		if err != nil && !errors.As(err, &rpcErr) {
+			rpcErr = &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+		if err := s.reply(req.ID, result, rpcErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *lspServer) handle(req rpcRequest) (any, error) {
+	if s.shutdown && req.Method != "exit" {
+		return nil, &rpcError{Code: rpcInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":                1, // full
+				"documentFormattingProvider":      true,
+				"documentRangeFormattingProvider": true,
+				"documentOnTypeFormattingProvider": map[string]any{
+					"firstTriggerCharacter": "│",
+					"moreTriggerCharacter":  []string{"|"},
+				},
+				"codeActionProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "boxfmt"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		s.docs[params.TextDocument.URI] = params.TextDocument.Text
+		return nil, s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didChange":
+		var params struct {
+			TextDocument   textDocumentIdentifier `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			s.docs[params.TextDocument.URI] = params.ContentChanges[n-1].Text
+		}
+		return nil, s.publishDiagnostics(params.TextDocument.URI)
+	case "textDocument/didClose":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", map[string]any{
+			"uri":         params.TextDocument.URI,
+			"diagnostics": []lspDiagnostic{},
+		})
+
+	case "textDocument/formatting":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.format(params.TextDocument.URI, nil, false)
+	case "textDocument/rangeFormatting":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+			Range        lspRange               `json:"range"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		r := rangeLines(params.Range)
+		return s.format(params.TextDocument.URI, &r, false)
+	case "textDocument/onTypeFormatting":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+			Position     lspPosition            `json:"position"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		r := lineRange{start: params.Position.Line, end: params.Position.Line + 1}
+		return s.format(params.TextDocument.URI, &r, false)
+	case "textDocument/codeAction":
+		var params struct {
+			TextDocument textDocumentIdentifier `json:"textDocument"`
+			Range        lspRange               `json:"range"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, err
+		}
+		return s.codeActions(params.TextDocument.URI, rangeLines(params.Range))
+	}
+
+	if req.ID == nil {
+		// Unknown notifications such as $/cancelRequest are ignored
+		return nil, nil
+	}
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+// document returns the text and options of an open document, and whether
+// it is to be formatted: a document that the config excludes is not.
+func (s *lspServer) document(uri string) (string, options, bool, error) {
+	text, ok := s.docs[uri]
+	if !ok {
+		return "", options{}, false, fmt.Errorf("document not open: %s", uri)
+	}
+
+	opts := defaultOptions()
+	if path, ok := uriPath(uri); ok {
+		// A broken config should not stop formatting
+		resolved, included, err := s.resolver.resolve(path)
+		switch {
+		case err != nil:
+		case !included:
+			return text, opts, false, nil
+		default:
+			opts = resolved
+		}
+	}
+	// The editor has already decoded the document
+	opts.encoding = ""
+	setAmbiguousWidth(opts.ambiguousWidth)
+	return text, opts, true, nil
+}
+
+// format returns the edits formatting the document, or the part of it
+// overlapping lines when that is not nil. convert selects the table
+// conversions in both directions instead of plain formatting.
+func (s *lspServer) format(uri string, lines *lineRange, convert bool) ([]lspTextEdit, error) {
+	text, opts, included, err := s.document(uri)
+	if err != nil || !included {
+		return []lspTextEdit{}, err
+	}
+	if convert {
+		opts.toTable = true
+		opts.fromTable = true
+	}
+
+	var edit *textEdit
+	if lines != nil {
+		edit, _ = formatRange(text, lines.start, lines.end, opts)
+	} else {
+		result, _ := processFile(text, opts)
+		edit = minimalEdit(text, result)
+	}
+	if edit == nil {
+		return []lspTextEdit{}, nil
+	}
+	return []lspTextEdit{toLSPEdit(text, *edit)}, nil
+}
+
+// codeActions offers to convert the boxes and Markdown tables within lines
+// into each other.
+func (s *lspServer) codeActions(uri string, lines lineRange) ([]lspCodeAction, error) {
+	text, opts, included, err := s.document(uri)
+	if err != nil || !included {
+		return []lspCodeAction{}, err
+	}
+
+	contentLines, _ := splitLines(text, opts.tabWidth)
+	actions := []lspCodeAction{}
+	addAction := func(title string, start, end int) {
+		edits, err := s.format(uri, &lineRange{start: start, end: end}, true)
+		if err != nil || len(edits) == 0 {
+			return
+		}
+		actions = append(actions, lspCodeAction{
+			Title: title,
+			Kind:  "refactor.rewrite",
+			Edit:  lspWorkspaceEdit{Changes: map[string][]lspTextEdit{uri: edits}},
+		})
+	}
+
+	for _, region := range detectBoxRegions(classifyLines(contentLines), opts) {
+		if overlapsAny([]lineRange{lines}, region.startIdx, region.endIdx) && len(detectColumns(region).separators) > 0 {
+			addAction("Convert box to Markdown table", region.startIdx, region.endIdx)
+		}
+	}
+	for _, table := range detectMarkdownTables(contentLines) {
+		if overlapsAny([]lineRange{lines}, table.startIdx, table.endIdx) {
+			addAction("Convert Markdown table to box", table.startIdx, table.endIdx)
+		}
+	}
+	return actions, nil
+}
+
+// publishDiagnostics sends the problems found in the document: boxes that
+// cannot be formatted, and boxes that formatting would change.
+func (s *lspServer) publishDiagnostics(uri string) error {
+	text, opts, included, err := s.document(uri)
+	if err != nil {
+		return err
+	}
+
+	diags := []lspDiagnostic{}
+	if !included {
+		return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diags})
+	}
+	r := formatContent(text, opts)
+	lines := strings.Split(text, "\n")
+	for _, d := range r.diags {
+		diags = append(diags, lspDiagnostic{
+			Range:    lineSpan(lines, d.line, d.line+1),
+			Severity: severityWarning,
+			Source:   "boxfmt",
+			Message:  d.message,
+		})
+	}
+	for _, c := range r.changed {
+		diags = append(diags, lspDiagnostic{
+			Range:    lineSpan(lines, c.start, c.end),
+			Severity: severityInformation,
+			Source:   "boxfmt",
+			Message:  "box is not formatted",
+		})
+	}
+	return s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": diags})
+}
+
+func (s *lspServer) reply(id json.RawMessage, result any, rpcErr *rpcError) error {
+	resp := rpcResponse{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if id == nil {
+		resp.ID = json.RawMessage("null")
+	}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		resp.Result = data
+	}
+	return writeMessage(s.out, resp)
+}
+
+func (s *lspServer) notify(method string, params any) error {
+	return writeMessage(s.out, rpcNotification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// readMessage reads one message framed by a Content-Length header.
+func readMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && line != "" {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length: %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message without Content-Length")
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func writeMessage(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+// uriPath returns the file path of a file:// URI.
+func uriPath(uri string) (string, bool) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// rangeLines returns the lines an LSP range touches. An end at the start of
+// a line does not include that line.
+func rangeLines(r lspRange) lineRange {
+	end := r.End.Line + 1
+	if r.End.Character == 0 && r.End.Line > r.Start.Line {
+		end = r.End.Line
+	}
+	return lineRange{start: r.Start.Line, end: end}
+}
+
+// lineSpan returns the LSP range from the start of line start to the start
+// of line end, or to the end of the document when end is past it.
+func lineSpan(lines []string, start, end int) lspRange {
+	if end < len(lines) {
+		return lspRange{Start: lspPosition{Line: start}, End: lspPosition{Line: end}}
+	}
+	last := len(lines) - 1
+	return lspRange{
+		Start: lspPosition{Line: min(start, last)},
+		End:   lspPosition{Line: last, Character: utf16Len(lines[last])},
+	}
+}
+
+func toLSPEdit(text string, edit textEdit) lspTextEdit {
+	return lspTextEdit{
+		Range:   lineSpan(strings.Split(text, "\n"), edit.startLine, edit.endLine),
+		NewText: edit.newText,
+	}
+}
+
+// utf16Len returns the length of s in UTF-16 code units.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lspSession runs the server over the given messages and returns the
+// messages it wrote.
+func lspSession(t *testing.T, messages ...string) []map[string]any {
+	t.Helper()
+	var in bytes.Buffer
+	for _, m := range messages {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(m), m)
+	}
+	var out bytes.Buffer
+	s := newLSPServer(&in, &out)
+	if err := s.serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	var replies []map[string]any
+	r := bufio.NewReader(&out)
+	for {
+		data, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		replies = append(replies, msg)
+	}
+	return replies
+}
+
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLSPFormatting(t *testing.T) {
+	text := "# 見出し\n┌──┐\n│ 日本 │\n└──┘\n\n┌──┐\n│ b │\n└──┘"
+	open := jsonString(t, map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params": map[string]any{
+			"textDocument": map[string]any{"uri": "file:///tmp/doc.md", "languageId": "markdown", "version": 1, "text": text},
+		},
+	})
+
+	replies := lspSession(t,
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`,
+		`{"jsonrpc":"2.0","method":"initialized","params":{}}`,
+		open,
+		`{"jsonrpc":"2.0","id":2,"method":"textDocument/formatting","params":{"textDocument":{"uri":"file:///tmp/doc.md"},"options":{"tabSize":4,"insertSpaces":true}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"textDocument/rangeFormatting","params":{"textDocument":{"uri":"file:///tmp/doc.md"},"range":{"start":{"line":6,"character":0},"end":{"line":6,"character":3}}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"textDocument/onTypeFormatting","params":{"textDocument":{"uri":"file:///tmp/doc.md"},"position":{"line":2,"character":6},"ch":"│"}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"textDocument/hover","params":{}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","method":"exit"}`,
+	)
+
+	got := make([]string, len(replies))
+	for i, r := range replies {
+		delete(r, "jsonrpc")
+		if r["id"] == 1.0 {
+			r["result"] = "capabilities"
+		}
+		got[i] = jsonString(t, r)
+	}
+	want := []string{
+		`{"id":1,"result":"capabilities"}`,
+		`{"method":"textDocument/publishDiagnostics","params":{"diagnostics":[` +
+			`{"message":"box is not formatted","range":{"end":{"character":0,"line":4},"start":{"character":0,"line":1}},"severity":3,"source":"boxfmt"},` +
+			`{"message":"box is not formatted","range":{"end":{"character":4,"line":7},"start":{"character":0,"line":5}},"severity":3,"source":"boxfmt"}` +
+			`],"uri":"file:///tmp/doc.md"}}`,
+		`{"id":2,"result":[{"newText":"┌──────┐\n│ 日本 │\n└──────┘\n\n┌───┐\n│ b │\n└───┘","range":{"end":{"character":4,"line":7},"start":{"character":0,"line":1}}}]}`,
+		`{"id":3,"result":[{"newText":"┌───┐\n│ b │\n└───┘","range":{"end":{"character":4,"line":7},"start":{"character":0,"line":5}}}]}`,
+		`{"id":4,"result":[{"newText":"┌──────┐\n│ 日本 │\n└──────┘\n","range":{"end":{"character":0,"line":4},"start":{"character":0,"line":1}}}]}`,
+		`{"error":{"code":-32601,"message":"method not found: textDocument/hover"},"id":5}`,
+		`{"id":6,"result":null}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLSPCodeAction(t *testing.T) {
+	text := "┌───┬───┐\n│ a │ b │\n├───┼───┤\n│ 1 │ 2 │\n└───┴───┘\n\n| x | y |\n|---|---|\n| 1 | 2 |\n"
+	open := jsonString(t, map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params":  map[string]any{"textDocument": map[string]any{"uri": "file:///tmp/doc.md", "text": text}},
+	})
+
+	replies := lspSession(t,
+		open,
+		`{"jsonrpc":"2.0","id":1,"method":"textDocument/codeAction","params":{"textDocument":{"uri":"file:///tmp/doc.md"},"range":{"start":{"line":0,"character":0},"end":{"line":9,"character":0}},"context":{"diagnostics":[]}}}`,
+	)
+	if len(replies) != 2 {
+		t.Fatalf("got %d messages, want 2", len(replies))
+	}
+
+	var actions []lspCodeAction
+	if err := json.Unmarshal([]byte(jsonString(t, replies[1]["result"])), &actions); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("got %d actions, want 2: %+v", len(actions), actions)
+	}
+
+	toTable := actions[0].Edit.Changes["file:///tmp/doc.md"]
+	if actions[0].Title != "Convert box to Markdown table" || len(toTable) != 1 ||
+		toTable[0].NewText != "| a   | b   |\n| --- | --- |\n| 1   | 2   |\n" {
+		t.Errorf("unexpected first action: %+v", actions[0])
+	}
+	toBox := actions[1].Edit.Changes["file:///tmp/doc.md"]
+	if actions[1].Title != "Convert Markdown table to box" || len(toBox) != 1 ||
+		!strings.HasPrefix(toBox[0].NewText, "┌───┬───┐\n│ x │ y │\n") || toBox[0].Range.Start.Line != 6 {
+		t.Errorf("unexpected second action: %+v", actions[1])
+	}
+}
+
+func TestLSPExcludedDocument(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, ".boxfmt.toml"), `exclude = ["docs/**"]`)
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "docs", "a.md"))
+	open := jsonString(t, map[string]any{
+		"jsonrpc": "2.0",
+		"method":  "textDocument/didOpen",
+		"params":  map[string]any{"textDocument": map[string]any{"uri": uri, "text": "┌─┐\n│\tab │\n└─┘\n"}},
+	})
+
+	replies := lspSession(t,
+		open,
+		jsonString(t, map[string]any{
+			"jsonrpc": "2.0",
+			"id":      1,
+			"method":  "textDocument/formatting",
+			"params":  map[string]any{"textDocument": map[string]any{"uri": uri}},
+		}),
+	)
+	got := make([]string, len(replies))
+	for i, r := range replies {
+		delete(r, "jsonrpc")
+		got[i] = jsonString(t, r)
+	}
+	want := []string{
+		`{"method":"textDocument/publishDiagnostics","params":{"diagnostics":[],"uri":` + jsonString(t, uri) + `}}`,
+		`{"id":1,"result":[]}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLineSpanUTF16(t *testing.T) {
+	lines := strings.Split("a\n𝄞 日本", "\n")
+	got := lineSpan(lines, 1, 2)
+	want := lspRange{Start: lspPosition{Line: 1}, End: lspPosition{Line: 1, Character: 5}}
+	if got != want {
+		t.Errorf("lineSpan = %+v, want %+v", got, want)
+	}
+}
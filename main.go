@@ -1,18 +1,69 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 )
 
 func main() {
-	overwrite := flag.Bool("w", false, "overwrite the input file")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "render":
+			os.Exit(runRender(os.Args[2:]))
+		case "extract":
+			os.Exit(runExtract(os.Args[2:]))
+		case "export":
+			os.Exit(runExport(os.Args[2:]))
+		case "lsp":
+			os.Exit(runLSP(os.Args[2:]))
+		case "undo":
+			os.Exit(runUndo(os.Args[2:]))
+		}
+	}
+
+	overwrite := flag.Bool("w", false, "overwrite the input files")
 	output := flag.String("o", "", "output file path")
+	repair := flag.Bool("repair", false, "repair boxes with a missing edge or border")
+	padCells := flag.Bool("pad-cells", false, "fill rows that are missing cells with empty cells")
+	toTable := flag.Bool("to-table", false, "convert multi-column boxes into Markdown tables")
+	align := flag.String("align", "", "comma-separated column alignments (left, center, right)")
+	fromTable := flag.Bool("from-table", false, "convert Markdown tables into boxes")
+	style := flag.String("style", "unicode", "style of boxes drawn from tables: unicode or ascii")
+	tabWidth := flag.Int("tab-width", 4, "number of columns between tab stops")
+	ambiguousWidth := flag.Int("ambiguous-width", 0, "width of East Asian Ambiguous characters: 1 or 2 (0 to use the locale)")
+	preserveIndent := flag.Bool("preserve-indent", false, "keep the indentation of cell text relative to the least indented cell of its column")
+	uniform := flag.Bool("uniform", false, "draw consecutive boxes at a common width, with common column widths for boxes with as many columns")
+	padLeft := flag.Int("pad-left", 1, "number of spaces before the text of each cell")
+	padRight := flag.Int("pad-right", 1, "number of spaces after the text of each cell")
+	minColumnWidth := flag.Int("min-column-width", 0, "smallest width of the text of each column")
+	maxWidth := flag.Int("max-width", 0, "wrap cells so boxes fit in this many columns, and warn about boxes that cannot (0 for no limit)")
+	var include, exclude globList
+	flag.Var(&include, "include", "glob of files to format in directories (default the config's include, or *.md,*.markdown); may be repeated")
+	flag.Var(&exclude, "exclude", "glob of files and directories to skip; may be repeated")
+	diffFile := flag.String("diff", "", "only format boxes overlapping the lines changed by this unified diff (- for stdin)")
+	diffBase := flag.String("diff-base", "", "only format boxes overlapping the lines changed since this git ref")
+	workers := flag.Int("j", runtime.GOMAXPROCS(0), "number of files to format in parallel")
+	watchMode := flag.Bool("watch", false, "keep running and reformat files in place whenever they change")
+	lines := flag.String("lines", "", "only format boxes overlapping this 1-based line range start:end")
+	encodingName := flag.String("encoding", "utf-8", "encoding of the input files: utf-8, sjis, eucjp or utf-16")
+	var backup backupFlag
+	flag.Var(&backup, "backup", "save the original of each overwritten file with this suffix (default "+defaultBackupSuffix+")")
+	configPath := flag.String("config", "", "config file to use instead of looking up .boxfmt.toml or .boxfmt.yaml")
 	flag.Parse()
 
 	if flag.NArg() < 1 {
-		fmt.Fprintln(os.Stderr, "usage: boxfmt [options] <file>")
+		fmt.Fprintln(os.Stderr, "usage: boxfmt [options] <file or directory>...")
+		fmt.Fprintln(os.Stderr, "       boxfmt render [options] [file]")
+		fmt.Fprintln(os.Stderr, "       boxfmt extract [options] <file>")
+		fmt.Fprintln(os.Stderr, "       boxfmt export [options] <file>")
+		fmt.Fprintln(os.Stderr, "       boxfmt lsp")
+		fmt.Fprintln(os.Stderr, "       boxfmt undo [options]")
 		os.Exit(1)
 	}
 
@@ -20,29 +71,268 @@ func main() {
 		fmt.Fprintln(os.Stderr, "error: -w and -o cannot be used together")
 		os.Exit(1)
 	}
+	if backup.suffix != "" && !*overwrite && !*watchMode {
+		fmt.Fprintln(os.Stderr, "error: -backup requires -w or -watch")
+		os.Exit(1)
+	}
+	if *diffFile != "" && *diffBase != "" {
+		fmt.Fprintln(os.Stderr, "error: -diff and -diff-base cannot be used together")
+		os.Exit(1)
+	}
+	if *lines != "" && (*diffFile != "" || *diffBase != "") {
+		fmt.Fprintln(os.Stderr, "error: -lines cannot be used with -diff or -diff-base")
+		os.Exit(1)
+	}
+	var lineLimit []lineRange
+	if *lines != "" {
+		r, err := parseLineRange(*lines)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -lines: %v\n", err)
+			os.Exit(1)
+		}
+		lineLimit = []lineRange{r}
+	}
 
-	inputPath := flag.Arg(0)
+	aligns, err := parseAlignments(*align)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -align: %v\n", err)
+		os.Exit(1)
+	}
 
-	data, err := os.ReadFile(inputPath)
+	boxStyle, err := parseStyle(*style)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		fmt.Fprintf(os.Stderr, "error: -style: %v\n", err)
 		os.Exit(1)
 	}
 
-	content := string(data)
-	result := processFile(content)
+	textEncodingName, err := parseEncoding(*encodingName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -encoding: %v\n", err)
+		os.Exit(1)
+	}
 
-	if *overwrite {
-		if err := os.WriteFile(inputPath, []byte(result), 0644); err != nil {
+	if *tabWidth < 1 {
+		fmt.Fprintln(os.Stderr, "error: -tab-width must be at least 1")
+		os.Exit(1)
+	}
+	if *ambiguousWidth < 0 || *ambiguousWidth > 2 {
+		fmt.Fprintln(os.Stderr, "error: -ambiguous-width must be 1 or 2")
+		os.Exit(1)
+	}
+	if *workers < 1 {
+		fmt.Fprintln(os.Stderr, "error: -j must be at least 1")
+		os.Exit(1)
+	}
+	if *padLeft < 0 || *padRight < 0 {
+		fmt.Fprintln(os.Stderr, "error: -pad-left and -pad-right must not be negative")
+		os.Exit(1)
+	}
+	if *minColumnWidth < 0 {
+		fmt.Fprintln(os.Stderr, "error: -min-column-width must not be negative")
+		os.Exit(1)
+	}
+	if *maxWidth < 0 {
+		fmt.Fprintln(os.Stderr, "error: -max-width must not be negative")
+		os.Exit(1)
+	}
+
+	// Flags given on the command line override the config files
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	flagOptions := func(opts options) options {
+		if set["repair"] {
+			opts.repair = *repair
+		}
+		if set["pad-cells"] {
+			opts.padCells = *padCells
+		}
+		if set["to-table"] {
+			opts.toTable = *toTable
+		}
+		if set["align"] {
+			opts.align = aligns
+		}
+		if set["from-table"] {
+			opts.fromTable = *fromTable
+		}
+		if set["style"] {
+			opts.style = boxStyle
+		}
+		if set["tab-width"] {
+			opts.tabWidth = *tabWidth
+		}
+		if set["ambiguous-width"] {
+			opts.ambiguousWidth = *ambiguousWidth
+		}
+		if set["preserve-indent"] {
+			opts.preserveIndent = *preserveIndent
+		}
+		if set["uniform"] {
+			opts.uniform = *uniform
+		}
+		if set["pad-left"] {
+			opts.padLeft = *padLeft
+		}
+		if set["pad-right"] {
+			opts.padRight = *padRight
+		}
+		if set["min-column-width"] {
+			opts.minColumnWidth = *minColumnWidth
+		}
+		if set["max-width"] {
+			opts.maxWidth = *maxWidth
+		}
+		if set["encoding"] {
+			opts.encoding = textEncodingName
+		}
+		return opts
+	}
+
+	resolver := newOptionResolver(flagOptions)
+	resolver.include = len(include) > 0
+	if *configPath != "" {
+		if resolver.fixed, err = loadConfig(*configPath); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-	} else if *output != "" {
-		if err := os.WriteFile(*output, []byte(result), 0644); err != nil {
-			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+
+	var changes map[string][]lineRange
+	switch {
+	case *diffFile != "":
+		changes, err = loadDiff(*diffFile)
+	case *diffBase != "":
+		changes, err = gitDiff(*diffBase)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
+	walker, err := newFileWalker(include, exclude)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	walker.config = resolver.config
+	if *watchMode {
+		if *output != "" || lineLimit != nil || changes != nil {
+			fmt.Fprintln(os.Stderr, "error: -watch cannot be used with -o, -lines, -diff or -diff-base")
 			os.Exit(1)
 		}
-	} else {
-		fmt.Print(result)
+		os.Exit(watchFiles(flag.Args(), walker, resolver, backup.suffix))
+	}
+
+	files, errs := walker.files(flag.Args())
+	failed := len(errs) > 0
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	if *output != "" && len(files) > 1 {
+		fmt.Fprintln(os.Stderr, "error: -o cannot be used with multiple files")
+		os.Exit(1)
+	}
+	if lineLimit != nil && len(files) > 1 {
+		fmt.Fprintln(os.Stderr, "error: -lines cannot be used with multiple files")
+		os.Exit(1)
+	}
+
+	var jobs []fileJob
+	for _, inputPath := range files {
+		opts, ok, err := resolver.resolve(inputPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			failed = true
+			continue
+		}
+		if !ok {
+			// Only a file named on the command line gets here; it is
+			// written out as it is rather than dropped
+			fmt.Fprintf(os.Stderr, "%s: excluded by the config; left unchanged\n", inputPath)
+			opts.lines = []lineRange{}
+			jobs = append(jobs, fileJob{path: inputPath, opts: opts})
+			continue
+		}
+		if changes != nil {
+			opts.lines = changedLines(changes, inputPath)
+		}
+		if lineLimit != nil {
+			opts.lines = lineLimit
+		}
+		jobs = append(jobs, fileJob{path: inputPath, opts: opts})
+	}
+
+	// A single file is streamed to stdout rather than held until reported
+	var stdout io.Writer
+	if len(jobs) == 1 {
+		stdout = os.Stdout
+	}
+
+	dest := destination{overwrite: *overwrite, output: *output, stdout: stdout}
+	if *overwrite {
+		// Without a cache directory the run simply cannot be undone
+		var j *journal
+		if root, err := journalDir(); err == nil {
+			j = newJournal(root)
+		}
+		dest.keep = keepOriginal(backup.suffix, j)
+	}
+
+	errored := 0
+	runJobs(jobs, *workers, func(job fileJob) fileResult {
+		return formatJob(job, dest)
+	}, func(r fileResult) {
+		r.report(os.Stdout, os.Stderr)
+		if r.err != nil {
+			errored++
+		}
+	})
+	if errored > 1 {
+		fmt.Fprintf(os.Stderr, "error: %d of %d files could not be formatted\n", errored, len(jobs))
+	}
+	if failed || errored > 0 {
+		os.Exit(1)
+	}
+}
+
+// rewriteFile formats the file at path in place, writing it only if the
+// result differs, and reports whether it did. keep is passed on to
+// replaceFile.
+func rewriteFile(path string, opts options, keep func(path string, sum []byte) error) (bool, error) {
+	setAmbiguousWidth(opts.ambiguousWidth)
+	changed, diags, err := replaceFile(path, opts, keep)
+	for _, d := range diags {
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, d.line+1, d.message)
+	}
+	return changed, fileError(path, err)
+}
+
+// watchFiles reformats the files under paths whenever they change, until
+// interrupted, printing the path of each file rewritten. Originals are
+// backed up with backupSuffix unless it is empty.
+func watchFiles(paths []string, walker *fileWalker, resolver *optionResolver, backupSuffix string) int {
+	keep := keepOriginal(backupSuffix, nil)
+	w, err := newWatcher(paths, walker, func(path string) error {
+		opts, ok, err := resolver.resolve(path)
+		if err != nil || !ok {
+			return err
+		}
+		changed, err := rewriteFile(path, opts, keep)
+		if changed {
+			fmt.Println(path)
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := w.run(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// boxToMarkdownTable converts a parsed multi-column box into a GitHub
+// Flavored Markdown table. The rows above the first divider form the
+// header, or the first row when the box has no divider. When dividers also
+// separate the body, each body section becomes a single row whose lines
+// are joined with <br>.
+func boxToMarkdownTable(region boxRegion, table boxTable, opts options) ([]string, error) {
+	for i, cl := range region.lines {
+		for _, c := range table.cells[i] {
+			if c.span > 1 {
+				return nil, diagnostic{
+					line:    cl.lineNum,
+					message: "merged cells cannot be converted to a Markdown table; box left unchanged",
+				}
+			}
+		}
+	}
+
+	sections := table.sections(region)
+	if len(sections) == 0 {
+		return nil, nil
+	}
+
+	var header []string
+	var body [][]string
+	if len(sections) == 1 {
+		header = joinRows(sections[0][:1], table.numCols)
+		for _, row := range sections[0][1:] {
+			body = append(body, joinRows([][]cell{row}, table.numCols))
+		}
+	} else {
+		header = joinRows(sections[0], table.numCols)
+		for _, section := range sections[1:] {
+			if len(sections) == 2 {
+				for _, row := range section {
+					body = append(body, joinRows([][]cell{row}, table.numCols))
+				}
+				continue
+			}
+			body = append(body, joinRows(section, table.numCols))
+		}
+	}
+
+	return buildMarkdownTable(region.indent, header, body, table.align), nil
+}
+
+// joinRows merges the lines of a multi-line row into one row of Markdown
+// cell texts, joining the non-empty lines of each column with <br>.
+func joinRows(rows [][]cell, numCols int) []string {
+	texts := make([][]string, numCols)
+	for _, row := range rows {
+		for _, c := range row {
+			if c.text != "" {
+				texts[c.col] = append(texts[c.col], markdownCellText(c.text))
+			}
+		}
+	}
+
+	joined := make([]string, numCols)
+	for c, t := range texts {
+		joined[c] = strings.Join(t, "<br>")
+	}
+	return joined
+}
+
+// markdownCellText escapes the vertical bars in a box cell for use in a
+// Markdown table. Box-drawing verticals need no escaping in Markdown.
+func markdownCellText(text string) string {
+	text = strings.ReplaceAll(text, `\│`, "│")
+
+	var buf strings.Builder
+	prev := rune(0)
+	for _, r := range text {
+		if r == '|' && prev != '\\' {
+			buf.WriteRune('\\')
+		}
+		buf.WriteRune(r)
+		prev = r
+	}
+	return buf.String()
+}
+
+func buildMarkdownTable(indent string, header []string, body [][]string, aligns []alignment) []string {
+	widths := make([]int, len(header))
+	for c := range widths {
+		widths[c] = 3
+	}
+	for _, row := range append([][]string{header}, body...) {
+		for c, text := range row {
+			if w := stringWidth(text); w > widths[c] {
+				widths[c] = w
+			}
+		}
+	}
+
+	buildRow := func(row []string) string {
+		cells := make([]string, len(row))
+		for c, text := range row {
+			cells[c] = fillAligned(text, widths[c], aligns[c])
+		}
+		return indent + "| " + strings.Join(cells, " | ") + " |"
+	}
+
+	delimiters := make([]string, len(widths))
+	for c, w := range widths {
+		delimiters[c] = markdownDelimiter(w, aligns[c])
+	}
+
+	lines := []string{buildRow(header), indent + "| " + strings.Join(delimiters, " | ") + " |"}
+	for _, row := range body {
+		lines = append(lines, buildRow(row))
+	}
+	return lines
+}
+
+func markdownDelimiter(width int, align alignment) string {
+	switch align {
+	case alignLeft:
+		return ":" + strings.Repeat("-", width-1)
+	case alignCenter:
+		return ":" + strings.Repeat("-", width-2) + ":"
+	case alignRight:
+		return strings.Repeat("-", width-1) + ":"
+	}
+	return strings.Repeat("-", width)
+}
+
+// markdownTable is a GitHub Flavored Markdown table in the input. rows
+// holds the header row first, followed by the body rows.
+type markdownTable struct {
+	startIdx int
+	endIdx   int
+	indent   string
+	align    []alignment
+	rows     [][]string
+	lineNums []int
+}
+
+// detectMarkdownTables finds the tables in lines. Tables in fenced code
+// blocks and in code indented by four or more spaces are not rendered, so
+// they are skipped.
+func detectMarkdownTables(lines []string) []markdownTable {
+	var tables []markdownTable
+	blocks := codeBlocks(lines)
+	for i := 0; i+1 < len(lines); i++ {
+		header := splitMarkdownRow(lines[i])
+		if header == nil || len(getIndent(lines[i])) >= 4 || inCodeBlock(blocks, i) {
+			continue
+		}
+		align, ok := parseDelimiterRow(lines[i+1])
+		if !ok || len(align) != len(header) {
+			continue
+		}
+
+		table := markdownTable{
+			startIdx: i,
+			indent:   getIndent(lines[i]),
+			align:    align,
+			rows:     [][]string{header},
+			lineNums: []int{i},
+		}
+		j := i + 2
+		for ; j < len(lines); j++ {
+			row := splitMarkdownRow(lines[j])
+			if row == nil {
+				break
+			}
+			table.rows = append(table.rows, row)
+			table.lineNums = append(table.lineNums, j)
+		}
+		table.endIdx = j
+		tables = append(tables, table)
+		i = j - 1
+	}
+	return tables
+}
+
+// splitMarkdownRow splits a table row on its unescaped pipes, or returns
+// nil if the line has none. The leading and trailing pipes are optional.
+func splitMarkdownRow(line string) []string {
+	s := strings.TrimSpace(line)
+	var cells []string
+	var current []rune
+	pipes := 0
+	prev := rune(0)
+	for _, r := range s {
+		if r == '|' && prev != '\\' {
+			cells = append(cells, strings.TrimSpace(string(current)))
+			current = nil
+			pipes++
+		} else {
+			current = append(current, r)
+		}
+		prev = r
+	}
+	if pipes == 0 {
+		return nil
+	}
+	cells = append(cells, strings.TrimSpace(string(current)))
+
+	if strings.HasPrefix(s, "|") {
+		cells = cells[1:]
+	}
+	if strings.HasSuffix(s, "|") && !strings.HasSuffix(s, `\|`) {
+		cells = cells[:len(cells)-1]
+	}
+	if len(cells) == 0 {
+		return nil
+	}
+	return cells
+}
+
+// parseDelimiterRow parses a delimiter row such as "| --- | :-: | --: |".
+func parseDelimiterRow(line string) ([]alignment, bool) {
+	cells := splitMarkdownRow(line)
+	if cells == nil {
+		return nil, false
+	}
+
+	aligns := make([]alignment, len(cells))
+	for c, text := range cells {
+		left := strings.HasPrefix(text, ":")
+		right := strings.HasSuffix(text, ":")
+		dashes := strings.TrimSuffix(strings.TrimPrefix(text, ":"), ":")
+		if dashes == "" || strings.Trim(dashes, "-") != "" {
+			return nil, false
+		}
+		switch {
+		case left && right:
+			aligns[c] = alignCenter
+		case left:
+			aligns[c] = alignLeft
+		case right:
+			aligns[c] = alignRight
+		}
+	}
+	return aligns, true
+}
+
+// toBox draws the table as a box in opts.style, with a divider under the
+// header and the table's own column alignment. Tables are left unchanged
+// unless opts.fromTable is set.
+func (t markdownTable) toBox(opts options) ([]string, error) {
+	if !opts.fromTable {
+		return nil, nil
+	}
+
+	numCols := len(t.align)
+	rows := make([][]string, len(t.rows))
+	for r, row := range t.rows {
+		if len(row) > numCols && !allEmpty(row[numCols:]) {
+			return nil, diagnostic{
+				line:    t.lineNums[r],
+				message: fmt.Sprintf("row has %d cells but the header has %d; table left unchanged", len(row), numCols),
+			}
+		}
+		rows[r] = make([]string, numCols)
+		for c := range rows[r] {
+			if c < len(row) {
+				// Box-drawing verticals would split the cell once boxed
+				rows[r][c] = strings.ReplaceAll(row[c], "│", `\│`)
+			}
+		}
+	}
+
+	return drawBox(t.indent, rows, true, mergeAlignments(t.align, opts.align), opts), nil
+}
+
+// codeBlock is a fenced code block: the lines from its opening fence up to
+// and including its closing fence. closed is false for a block that runs
+// to the end of the text.
+type codeBlock struct {
+	lineRange
+	closed bool
+}
+
+// codeBlocks returns the fenced code blocks in lines.
+func codeBlocks(lines []string) []codeBlock {
+	var blocks []codeBlock
+	open := -1
+	var fence string
+	for i, line := range lines {
+		if open < 0 {
+			if fence, _ = openingFence(line); fence != "" {
+				open = i
+			}
+			continue
+		}
+		if closesFence(line, fence) {
+			blocks = append(blocks, codeBlock{lineRange: lineRange{start: open, end: i + 1}, closed: true})
+			open = -1
+		}
+	}
+	if open >= 0 {
+		blocks = append(blocks, codeBlock{lineRange: lineRange{start: open, end: len(lines)}})
+	}
+	return blocks
+}
+
+// openingFence returns the run of backticks or tildes that opens a fenced
+// code block on line, if it does.
+func openingFence(line string) (string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", false
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	// The info string of a backtick fence cannot hold backticks
+	if n < 3 || (trimmed[0] == '`' && strings.Contains(trimmed[n:], "`")) {
+		return "", false
+	}
+	return trimmed[:n], true
+}
+
+// closesFence reports whether line closes the code block opened by fence.
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	rest := strings.TrimLeft(trimmed, fence[:1])
+	return len(trimmed)-len(rest) >= len(fence) && strings.TrimSpace(rest) == ""
+}
+
+// inCodeBlock reports whether line i is part of one of blocks.
+func inCodeBlock(blocks []codeBlock, i int) bool {
+	for _, b := range blocks {
+		if b.start <= i && i < b.end {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosingBlock returns the code block holding lines [start, end), if any.
+func enclosingBlock(blocks []codeBlock, start, end int) (codeBlock, bool) {
+	for _, b := range blocks {
+		if b.start < start && end <= b.end {
+			return b, true
+		}
+	}
+	return codeBlock{}, false
+}
+
+// holdsOnly reports whether block holds nothing but blank lines apart from
+// lines [start, end), so that its fences can be removed.
+func (b codeBlock) holdsOnly(lines []string, start, end int) bool {
+	return b.closed && end < b.end && allBlank(lines[b.start+1:start]) && allBlank(lines[end:b.end-1])
+}
+
+func allBlank(lines []string) bool {
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// isMarkdownTable reports whether lines start with a table header and
+// delimiter row.
+func isMarkdownTable(lines []string) bool {
+	if len(lines) < 2 || splitMarkdownRow(lines[0]) == nil {
+		return false
+	}
+	_, ok := parseDelimiterRow(lines[1])
+	return ok
+}
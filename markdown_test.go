@@ -0,0 +1,289 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestBoxToMarkdownTable(t *testing.T) {
+	toTable := defaultOptions()
+	toTable.toTable = true
+
+	tests := []struct {
+		name  string
+		input []string
+		want  []string
+	}{
+		{
+			"header from divider",
+			[]string{"┌──┬──┐", "│ Name│ 説明 │", "├──┼──┤", "│ A│ テスト │", "│ Bob│ 短い │", "└──┴──┘"},
+			[]string{"| Name | 説明   |", "| ---- | ------ |", "| A    | テスト |", "| Bob  | 短い   |"},
+		},
+		{
+			"first row as header",
+			[]string{"+--+--+", "| a | b |", "| c | d |", "+--+--+"},
+			[]string{"| a   | b   |", "| --- | --- |", "| c   | d   |"},
+		},
+		{
+			"multi-line rows",
+			[]string{"┌──┬──┐", "│ k │ v │", "├──┼──┤", "│ a │ one │", "│   │ two │", "├──┼──┤", "│ b │ three │", "└──┴──┘"},
+			[]string{"| k   | v          |", "| --- | ---------- |", "| a   | one<br>two |", "| b   | three      |"},
+		},
+		{
+			"escaped pipes",
+			[]string{"+--+--+", "| cmd | out |", "| `ls | wc` | a \\| b |", "+--+--+"},
+			[]string{"| cmd        | out    |", "| ---------- | ------ |", "| `ls \\| wc` | a \\| b |"},
+		},
+		{
+			"single column is not converted",
+			[]string{"┌──┐", "│ hi │", "└──┘"},
+			[]string{"┌────┐", "│ hi │", "└────┘"},
+		},
+	}
+	for _, tt := range tests {
+		result, diags := processFile(strings.Join(tt.input, "\n"), toTable)
+		if len(diags) != 0 {
+			t.Errorf("%s: unexpected diagnostics: %v", tt.name, diags)
+		}
+		want := strings.Join(tt.want, "\n")
+		if result != want {
+			t.Errorf("%s:\n--- got ---\n%s\n--- want ---\n%s", tt.name, result, want)
+		}
+	}
+}
+
+func TestBoxToMarkdownTableAlignment(t *testing.T) {
+	opts := defaultOptions()
+	opts.toTable = true
+	opts.align = []alignment{alignLeft, alignCenter, alignRight}
+
+	input := strings.Join([]string{"+-+-+-+", "| a | b | c |", "+-+-+-+", "| 1 | 2 | 3 |", "+-+-+-+"}, "\n")
+	want := strings.Join([]string{"| a   |  b  |   c |", "| :-- | :-: | --: |", "| 1   |  2  |   3 |"}, "\n")
+
+	result, _ := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestBoxToMarkdownTableMergedCells(t *testing.T) {
+	opts := defaultOptions()
+	opts.toTable = true
+
+	input := strings.Join([]string{"┌──┬──┐", "│ A│ B│", "├──┴──┤", "│ merged │", "└─────┘"}, "\n")
+	result, diags := processFile(input, opts)
+	if result != input {
+		t.Errorf("box with merged cells was modified:\n%s", result)
+	}
+	if len(diags) != 1 || diags[0].line != 3 {
+		t.Errorf("diagnostics = %v, want one on line index 3", diags)
+	}
+}
+
+func TestBoxToMarkdownTableInCodeBlock(t *testing.T) {
+	opts := defaultOptions()
+	opts.toTable = true
+
+	input := strings.Join([]string{"text", "```", "+-+-+", "| a | b |", "+-+-+", "```", "more"}, "\n")
+	want := strings.Join([]string{"text", "| a   | b   |", "| --- | --- |", "more"}, "\n")
+	result, diags := processFile(input, opts)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+
+	shared := strings.Join([]string{"~~~", "note", "+-+-+", "| a | b |", "+-+-+", "~~~"}, "\n")
+	result, diags = processFile(shared, opts)
+	if result != shared {
+		t.Errorf("box sharing a code block was modified:\n%s", result)
+	}
+	if len(diags) != 1 || diags[0].line != 2 {
+		t.Errorf("diagnostics = %v, want one on line index 2", diags)
+	}
+}
+
+func TestCodeBlocks(t *testing.T) {
+	lines := []string{"```go", "x", "~~~", "````", "text", "   ~~~ sh", "y"}
+	got := codeBlocks(lines)
+	want := []codeBlock{
+		{lineRange: lineRange{start: 0, end: 4}, closed: true},
+		{lineRange: lineRange{start: 5, end: 7}},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("codeBlocks = %v, want %v", got, want)
+	}
+}
+
+func TestTableDirective(t *testing.T) {
+	input := strings.Join([]string{
+		"<!-- boxfmt: table align=,right -->",
+		"",
+		"+--+--+",
+		"| a | b |",
+		"+--+--+",
+		"",
+		"+--+--+",
+		"| c | d |",
+		"+--+--+",
+	}, "\n")
+	want := strings.Join([]string{
+		"<!-- boxfmt: table align=,right -->",
+		"",
+		"| a   |   b |",
+		"| --- | --: |",
+		"",
+		"+---+---+",
+		"| c | d |",
+		"+---+---+",
+	}, "\n")
+
+	result, diags := processFile(input, defaultOptions())
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestSplitMarkdownRow(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"| a | b |", []string{"a", "b"}},
+		{"a | b", []string{"a", "b"}},
+		{"| a \\| b | c |", []string{"a \\| b", "c"}},
+		{"| a | b \\|", []string{"a", "b \\|"}},
+		{"no pipes here", nil},
+	}
+	for _, tt := range tests {
+		got := splitMarkdownRow(tt.input)
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") || (got == nil) != (tt.want == nil) {
+			t.Errorf("splitMarkdownRow(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseDelimiterRow(t *testing.T) {
+	aligns, ok := parseDelimiterRow("| --- | :-- | :-: | --: |")
+	if !ok {
+		t.Fatal("delimiter row not recognized")
+	}
+	want := []alignment{alignDefault, alignLeft, alignCenter, alignRight}
+	for i := range want {
+		if aligns[i] != want[i] {
+			t.Errorf("alignment %d = %v, want %v", i, aligns[i], want[i])
+		}
+	}
+
+	for _, line := range []string{"| a | b |", "| --- | -x- |", "| : |"} {
+		if _, ok := parseDelimiterRow(line); ok {
+			t.Errorf("parseDelimiterRow(%q) recognized a non-delimiter row", line)
+		}
+	}
+}
+
+func TestMarkdownTableToBox(t *testing.T) {
+	input := strings.Join([]string{
+		"Intro",
+		"",
+		"  | Name | 説明 | n |",
+		"  | :--- | :--: | --: |",
+		"  | A | テスト | 1 |",
+		"  | Bob | x \\| y | 100 |",
+		"",
+		"End",
+	}, "\n")
+	want := strings.Join([]string{
+		"Intro",
+		"",
+		"  ┌──────┬────────┬─────┐",
+		"  │ Name │  説明  │   n │",
+		"  ├──────┼────────┼─────┤",
+		"  │ A    │ テスト │   1 │",
+		"  │ Bob  │ x \\| y │ 100 │",
+		"  └──────┴────────┴─────┘",
+		"",
+		"End",
+	}, "\n")
+
+	opts := defaultOptions()
+	opts.fromTable = true
+	result, diags := processFile(input, opts)
+	if len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diags)
+	}
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+
+	again, _ := processFile(result, defaultOptions())
+	if again != result {
+		t.Errorf("converted box is not stable:\n%s", again)
+	}
+
+	back := defaultOptions()
+	back.toTable = true
+	table, _ := processFile(result, back)
+	if !strings.Contains(table, "| ---- | :----: | --: |") {
+		t.Errorf("round trip lost the column alignment:\n%s", table)
+	}
+	if !strings.Contains(table, "| Bob  | x \\| y | 100 |") {
+		t.Errorf("round trip lost the escaped pipe:\n%s", table)
+	}
+}
+
+func TestMarkdownTableToASCIIBox(t *testing.T) {
+	opts := defaultOptions()
+	opts.fromTable = true
+	opts.style = styleASCII
+
+	input := "| a | b |\n|---|---|\n| 1 | 2 |\n"
+	want := "+---+---+\n| a | b |\n+---+---+\n| 1 | 2 |\n+---+---+\n"
+	result, _ := processFile(input, opts)
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
+
+func TestMarkdownTableExtraCells(t *testing.T) {
+	opts := defaultOptions()
+	opts.fromTable = true
+
+	input := "| a | b |\n|---|---|\n| 1 | 2 | 3 |\n| 4 |\n"
+	result, diags := processFile(input, opts)
+	if result != input {
+		t.Errorf("table with extra cells was modified:\n%s", result)
+	}
+	if len(diags) != 1 || diags[0].line != 2 {
+		t.Errorf("diagnostics = %v, want one on line index 2", diags)
+	}
+}
+
+func TestMarkdownTableInCode(t *testing.T) {
+	opts := defaultOptions()
+	opts.fromTable = true
+
+	for _, input := range []string{
+		"```\n| a | b |\n|---|---|\n| 1 | 2 |\n```\n",
+		"~~~~ md\n| a | b |\n|---|---|\n~~~~\n",
+		"Example:\n\n    | a | b |\n    |---|---|\n    | 1 | 2 |\n",
+	} {
+		if result, _ := processFile(input, opts); result != input {
+			t.Errorf("table in code was converted:\n%s", result)
+		}
+	}
+}
+
+func TestBoxDirective(t *testing.T) {
+	input := "<!-- boxfmt: box -->\n| a | b |\n|---|---|\n\n| c | d |\n|---|---|\n"
+	want := "<!-- boxfmt: box -->\n┌───┬───┐\n│ a │ b │\n├───┼───┤\n└───┴───┘\n\n| c | d |\n|---|---|\n"
+	result, _ := processFile(input, defaultOptions())
+	if result != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", result, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// boxStyle is the set of characters used to draw new boxes.
+type boxStyle int
+
+const (
+	styleUnicode boxStyle = iota
+	styleASCII
+)
+
+func parseStyle(s string) (boxStyle, error) {
+	switch strings.ToLower(s) {
+	case "", "unicode":
+		return styleUnicode, nil
+	case "ascii":
+		return styleASCII, nil
+	}
+	return styleUnicode, fmt.Errorf("unknown style %q", s)
+}
+
+// alignment is the horizontal placement of text within a column.
+type alignment int
+
+const (
+	alignDefault alignment = iota
+	alignLeft
+	alignCenter
+	alignRight
+)
+
+// options controls how boxes are detected and formatted.
+type options struct {
+	// repair makes detection tolerate boxes with a missing right edge or
+	// a missing top/bottom border, and rebuilds the missing pieces.
+	repair bool
+
+	// padCells fills rows that have fewer cells than their section's
+	// columns with empty cells instead of leaving the box untouched.
+	padCells bool
+
+	// align holds the alignment of each column, starting from the left.
+	// Columns beyond its length use alignDefault, which is left-aligned.
+	align []alignment
+
+	// toTable converts multi-column boxes into Markdown tables.
+	toTable bool
+
+	// fromTable converts Markdown tables into boxes drawn in style.
+	fromTable bool
+	style     boxStyle
+
+	// maxWidth is the width that boxes are wrapped to fit, and that boxes
+	// which cannot be narrowed enough are reported for exceeding, or 0 for
+	// no limit.
+	maxWidth int
+
+	// padLeft and padRight are the number of spaces between a cell's text
+	// and the lines on either side of it.
+	padLeft  int
+	padRight int
+
+	// preserveIndent keeps the indentation of each cell's text beyond the
+	// smallest indentation in its column, instead of trimming it, so that
+	// trees and nested lists inside boxes keep their shape.
+	preserveIndent bool
+
+	// minColumnWidth is the smallest width of the text of a column.
+	minColumnWidth int
+
+	// width is the width of a box including its borders, or 0 to fit the
+	// content. Boxes whose content is wider than that stay wider. It is
+	// set by a directive rather than by a flag.
+	width int
+
+	// uniform draws each group of consecutive boxes at a common width,
+	// with common column widths for boxes with as many columns.
+	uniform bool
+
+	// columnWidths is the smallest width of each column, set for a box
+	// drawn uniformly with others. It applies only to boxes with that many
+	// columns.
+	columnWidths []int
+
+	// tabWidth is the number of columns between tab stops, used when
+	// expanding tabs in the input.
+	tabWidth int
+
+	// indentTabs indents boxes with tabs rather than spaces, and keeps the
+	// tabs in lines that are not reformatted.
+	indentTabs bool
+
+	// ambiguousWidth is the width of East Asian Ambiguous characters, 1 or
+	// 2, or 0 to decide from the locale.
+	ambiguousWidth int
+
+	// lines restricts formatting to the boxes and tables overlapping these
+	// ranges, leaving the rest of the file byte-for-byte unchanged. Nil
+	// formats everything.
+	lines []lineRange
+
+	// encoding is the name of the input's encoding as returned by
+	// parseEncoding, or "" for UTF-8. Output is written in the same
+	// encoding.
+	encoding string
+
+	// toHTML replaces boxes with HTML blocks. It is set by the export
+	// subcommand rather than by a flag.
+	toHTML bool
+}
+
+func defaultOptions() options {
+	return options{tabWidth: 4, padLeft: 1, padRight: 1}
+}
+
+// cellGap is the width between the text of two adjacent cells, taken by
+// their padding and the line between them.
+func (o options) cellGap() int {
+	return o.padLeft + o.padRight + 1
+}
+
+// parseAlignments parses a comma-separated list of column alignments such
+// as "left,center,right" or "l,c,r". An empty entry keeps the default.
+func parseAlignments(s string) ([]alignment, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var aligns []alignment
+	for _, name := range strings.Split(s, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+			aligns = append(aligns, alignDefault)
+		case "l", "left":
+			aligns = append(aligns, alignLeft)
+		case "c", "center":
+			aligns = append(aligns, alignCenter)
+		case "r", "right":
+			aligns = append(aligns, alignRight)
+		default:
+			return nil, fmt.Errorf("unknown alignment %q", name)
+		}
+	}
+	return aligns, nil
+}
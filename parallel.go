@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fileJob is a file to format with its resolved options.
+type fileJob struct {
+	path string
+	opts options
+}
+
+// fileResult is the outcome of formatting one file. Output meant for the
+// terminal is kept until the file's turn to be reported comes.
+type fileResult struct {
+	path   string
+	stdout string
+	diags  []diagnostic
+	err    error
+}
+
+// report writes the result's diagnostics and error to errOut and its
+// output to out.
+func (r fileResult) report(out, errOut io.Writer) {
+	for _, d := range r.diags {
+		fmt.Fprintf(errOut, "%s:%d: %s\n", r.path, d.line+1, d.message)
+	}
+	if r.err != nil {
+		fmt.Fprintf(errOut, "error: %v\n", r.err)
+	}
+	io.WriteString(out, r.stdout)
+}
+
+// destination is where formatJob writes the result: back to the file,
+// calling keep before it is replaced, to output, or to stdout. With none of
+// them set, the result is kept for the caller to write.
+type destination struct {
+	overwrite bool
+	keep      func(path string, sum []byte) error
+	output    string
+	stdout    io.Writer
+}
+
+// formatJob formats a file and writes the result to dest.
+func formatJob(job fileJob, dest destination) fileResult {
+	r := fileResult{path: job.path}
+	switch {
+	case dest.overwrite:
+		_, r.diags, r.err = replaceFile(job.path, job.opts, dest.keep)
+	case dest.output != "":
+		r.diags, r.err = writeOutput(job.path, dest.output, job.opts)
+	case dest.stdout != nil:
+		r.diags, r.err = formatFile(job.path, dest.stdout, job.opts)
+	default:
+		var b strings.Builder
+		r.diags, r.err = formatFile(job.path, &b, job.opts)
+		r.stdout = b.String()
+	}
+	r.err = fileError(job.path, r.err)
+	return r
+}
+
+// fileError adds path to a diagnostic returned as an error, such as for
+// invalid text.
+func fileError(path string, err error) error {
+	var d diagnostic
+	if errors.As(err, &d) {
+		return fmt.Errorf("%s:%d: %s", path, d.line+1, d.message)
+	}
+	return err
+}
+
+// writeOutput formats the file at path into the file output. A regular
+// output file is only replaced once formatting succeeds, so that an error
+// leaves it as it was.
+func writeOutput(path, output string, opts options) ([]diagnostic, error) {
+	// Writing would truncate the file before it is read
+	if in, err := os.Stat(path); err == nil {
+		if out, err := os.Stat(output); err == nil && os.SameFile(in, out) {
+			_, diags, err := replaceFile(path, opts, nil)
+			return diags, err
+		}
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	target := output
+	if info, err := os.Stat(output); err == nil {
+		if !info.Mode().IsRegular() {
+			// Devices and pipes cannot be replaced, and have nothing to lose
+			out, err := os.OpenFile(output, os.O_WRONLY, 0)
+			if err != nil {
+				return nil, err
+			}
+			diags, err := formatStream(in, out, opts)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			return diags, err
+		}
+		if target, err = filepath.EvalSymlinks(output); err != nil {
+			return nil, err
+		}
+	}
+
+	// A new file is created first to get the permissions one normally gets
+	created := false
+	if f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); err == nil {
+		f.Close()
+		created = true
+	} else if !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	var diags []diagnostic
+	err = writeAtomic(target, func(w io.Writer) (bool, error) {
+		var err error
+		diags, err = formatStream(in, w, opts)
+		return err == nil, err
+	})
+	if err != nil && created {
+		os.Remove(target)
+	}
+	return diags, err
+}
+
+// runJobs runs format on each job using up to workers goroutines and
+// passes the results to report in job order, each as soon as those before
+// it are done.
+//
+// The width of ambiguous characters is global, so jobs are run in batches
+// that share the same setting.
+func runJobs(jobs []fileJob, workers int, format func(fileJob) fileResult, report func(fileResult)) {
+	results := make([]*fileResult, len(jobs))
+	next := 0
+	var mu sync.Mutex
+	done := func(i int, r fileResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[i] = &r
+		for next < len(results) && results[next] != nil {
+			report(*results[next])
+			results[next] = nil
+			next++
+		}
+	}
+
+	for _, batch := range batchByAmbiguousWidth(jobs) {
+		setAmbiguousWidth(jobs[batch[0]].opts.ambiguousWidth)
+
+		indexes := make(chan int)
+		var wg sync.WaitGroup
+		for range min(workers, len(batch)) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					done(i, format(jobs[i]))
+				}
+			}()
+		}
+		for _, i := range batch {
+			indexes <- i
+		}
+		close(indexes)
+		wg.Wait()
+	}
+}
+
+// batchByAmbiguousWidth groups the indexes of jobs by their ambiguous
+// width setting, in order of first appearance.
+func batchByAmbiguousWidth(jobs []fileJob) [][]int {
+	var batches [][]int
+	index := make(map[int]int)
+	for i, job := range jobs {
+		b, ok := index[job.opts.ambiguousWidth]
+		if !ok {
+			b = len(batches)
+			index[job.opts.ambiguousWidth] = b
+			batches = append(batches, nil)
+		}
+		batches[b] = append(batches[b], i)
+	}
+	return batches
+}
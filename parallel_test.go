@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunJobsOrder(t *testing.T) {
+	var jobs []fileJob
+	for i := range 50 {
+		opts := defaultOptions()
+		// Interleave two ambiguous-width settings
+		opts.ambiguousWidth = 1 + i%2
+		jobs = append(jobs, fileJob{path: fmt.Sprint(i), opts: opts})
+	}
+
+	var reported []string
+	runJobs(jobs, 8, func(job fileJob) fileResult {
+		// Later jobs finish first
+		var i int
+		fmt.Sscan(job.path, &i)
+		time.Sleep(time.Duration(50-i) * 100 * time.Microsecond)
+
+		if w := stringWidth("○"); w != job.opts.ambiguousWidth {
+			t.Errorf("job %s ran with ambiguous width %d, want %d", job.path, w, job.opts.ambiguousWidth)
+		}
+		return fileResult{path: job.path}
+	}, func(r fileResult) {
+		reported = append(reported, r.path)
+	})
+	setAmbiguousWidth(0)
+
+	var want []string
+	for _, job := range jobs {
+		want = append(want, job.path)
+	}
+	if !slices.Equal(reported, want) {
+		t.Errorf("reported %v, want %v", reported, want)
+	}
+}
+
+func TestFormatJob(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "┌──┬──┐\n│ a │ b │ c │\n└──┴──┘\n\n┌─┐\n│ x │\n└─┘\n")
+
+	jobs := []fileJob{
+		{path: filepath.Join(dir, "missing.md"), opts: defaultOptions()},
+		{path: filepath.Join(dir, "a.md"), opts: defaultOptions()},
+	}
+	var stdout, stderr bytes.Buffer
+	runJobs(jobs, 2, func(job fileJob) fileResult {
+		return formatJob(job, destination{})
+	}, func(r fileResult) {
+		r.report(&stdout, &stderr)
+	})
+
+	if want := "┌──┬──┐\n│ a │ b │ c │\n└──┴──┘\n\n┌───┐\n│ x │\n└───┘\n"; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+	wantErr := "error: open " + filepath.Join(dir, "missing.md") + ": no such file or directory\n" +
+		filepath.Join(dir, "a.md") + ":2: row has 3 cells but only 2 columns; box left unchanged\n"
+	if stderr.String() != wantErr {
+		t.Errorf("stderr = %q, want %q", stderr.String(), wantErr)
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.md")
+	output := filepath.Join(dir, "out.md")
+	writeFile(t, input, "┌─┐\n│ x │\n└─┘\n")
+
+	if _, err := writeOutput(input, output, defaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(output); string(got) != "┌───┐\n│ x │\n└───┘\n" {
+		t.Errorf("output = %q", got)
+	}
+
+	// Invalid text leaves an existing output as it was
+	writeFile(t, input, "┌─┐\n│ \xff │\n└─┘\n")
+	writeFile(t, output, "precious")
+	if _, err := writeOutput(input, output, defaultOptions()); err == nil {
+		t.Error("invalid input was formatted")
+	}
+	if got, _ := os.ReadFile(output); string(got) != "precious" {
+		t.Errorf("output = %q, want it unchanged", got)
+	}
+
+	// and creates no new one
+	created := filepath.Join(dir, "new.md")
+	writeOutput(input, created, defaultOptions())
+	if _, err := os.Stat(created); !os.IsNotExist(err) {
+		t.Errorf("output created for invalid input: %v", err)
+	}
+}
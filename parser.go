@@ -15,11 +15,12 @@ const (
 )
 
 type classifiedLine struct {
-	raw      string
-	typ      lineType
-	indent   string
-	trimmed  string
-	isASCII  bool
+	raw     string
+	typ     lineType
+	indent  string
+	trimmed string
+	isASCII bool
+	lineNum int
 }
 
 type boxRegion struct {
@@ -63,6 +64,14 @@ func isBoxDrawing(r rune) bool {
 	return false
 }
 
+func isJunction(r rune) bool {
+	switch r {
+	case '┬', '┴', '┼', '+':
+		return true
+	}
+	return false
+}
+
 func firstNonSpace(s string) (rune, int) {
 	for i, r := range s {
 		if r != ' ' && r != '\t' {
@@ -89,7 +98,7 @@ func getIndent(s string) string {
 	return s
 }
 
-func isBorderLine(trimmed string, leftCorner, rightCorner, midJunction rune, horizontal rune) bool {
+func isBorderLine(trimmed string, leftCorner, rightCorner rune, junctions string, horizontal rune) bool {
 	runes := []rune(trimmed)
 	if len(runes) < 2 {
 		return false
@@ -101,7 +110,7 @@ func isBorderLine(trimmed string, leftCorner, rightCorner, midJunction rune, hor
 		return false
 	}
 	for _, r := range runes[1 : len(runes)-1] {
-		if r != horizontal && r != midJunction {
+		if r != horizontal && !strings.ContainsRune(junctions, r) {
 			return false
 		}
 	}
@@ -120,17 +129,17 @@ func classifyLine(line string) classifiedLine {
 	lastR := lastNonSpace(line)
 
 	// Unicode TopBorder: ┌...┐
-	if isBorderLine(trimmed, '┌', '┐', '┬', '─') {
+	if isBorderLine(trimmed, '┌', '┐', "┬", '─') {
 		return classifiedLine{raw: line, typ: lineTopBorder, indent: indent, trimmed: trimmed, isASCII: false}
 	}
 
 	// Unicode BottomBorder: └...┘
-	if isBorderLine(trimmed, '└', '┘', '┴', '─') {
+	if isBorderLine(trimmed, '└', '┘', "┴", '─') {
 		return classifiedLine{raw: line, typ: lineBottomBorder, indent: indent, trimmed: trimmed, isASCII: false}
 	}
 
-	// Unicode Divider: ├...┤
-	if isBorderLine(trimmed, '├', '┤', '┼', '─') {
+	// Unicode Divider: ├...┤, where ┬ and ┴ open or close merged cells
+	if isBorderLine(trimmed, '├', '┤', "┼┬┴", '─') {
 		return classifiedLine{raw: line, typ: lineDivider, indent: indent, trimmed: trimmed, isASCII: false}
 	}
 
@@ -176,11 +185,16 @@ func classifyLines(lines []string) []classifiedLine {
 	classified := make([]classifiedLine, len(lines))
 	for i, line := range lines {
 		classified[i] = classifyLine(line)
+		classified[i].lineNum = i
 	}
 	return classified
 }
 
-func detectBoxRegions(classified []classifiedLine) []boxRegion {
+func detectBoxRegions(classified []classifiedLine, opts options) []boxRegion {
+	if opts.repair {
+		classified = classifyOpenLines(classified)
+	}
+
 	var regions []boxRegion
 	n := len(classified)
 	i := 0
@@ -203,6 +217,10 @@ func detectBoxRegions(classified []classifiedLine) []boxRegion {
 		// Reclassify ASCII borders based on position
 		reclassifyASCIIBorders(group)
 
+		if opts.repair {
+			group = repairGroup(group)
+		}
+
 		// Check if this forms a valid box
 		if isValidBox(group) {
 			indent := commonIndent(group)
@@ -243,6 +261,137 @@ func reclassifyASCIIBorders(group []classifiedLine) {
 	}
 }
 
+// classifyOpenLines returns a copy of classified in which plain lines that
+// look like box lines with their right edge missing (e.g. "│ text" or
+// "┌─────") are closed and classified as such.
+func classifyOpenLines(classified []classifiedLine) []classifiedLine {
+	result := make([]classifiedLine, len(classified))
+	for i, cl := range classified {
+		if cl.typ == linePlain {
+			cl = classifyOpenLine(cl)
+		}
+		result[i] = cl
+	}
+	return result
+}
+
+func classifyOpenLine(cl classifiedLine) classifiedLine {
+	runes := []rune(cl.trimmed)
+	if len(runes) < 2 {
+		return cl
+	}
+
+	switch first := runes[0]; {
+	case first == '┌' && isOpenBorder(runes, "┬", '─'):
+		return closeLine(cl, lineTopBorder, "┐", false)
+	case first == '└' && isOpenBorder(runes, "┴", '─'):
+		return closeLine(cl, lineBottomBorder, "┘", false)
+	case first == '├' && isOpenBorder(runes, "┼┬┴", '─'):
+		return closeLine(cl, lineDivider, "┤", false)
+	case first == '+' && isOpenBorder(runes, "+", '-'):
+		return closeLine(cl, lineTopBorder, "+", true)
+	case isVertical(first):
+		return closeLine(cl, lineContent, " "+string(first), isASCIIVertical(first))
+	}
+	return cl
+}
+
+func isOpenBorder(runes []rune, junctions string, horizontal rune) bool {
+	hasHorizontal := false
+	for _, r := range runes[1:] {
+		if r == horizontal {
+			hasHorizontal = true
+			continue
+		}
+		if !strings.ContainsRune(junctions, r) {
+			return false
+		}
+	}
+	return hasHorizontal
+}
+
+func closeLine(cl classifiedLine, typ lineType, edge string, ascii bool) classifiedLine {
+	cl.typ = typ
+	cl.trimmed += edge
+	cl.isASCII = ascii
+	return cl
+}
+
+// repairGroup adds a missing top or bottom border to a group, deriving it
+// from the nearest border line. Groups without any border line are left
+// alone since they are far more likely to be Markdown tables than boxes.
+func repairGroup(group []classifiedLine) []classifiedLine {
+	first, last := -1, -1
+	for i, cl := range group {
+		if cl.typ == lineTopBorder || cl.typ == lineBottomBorder || cl.typ == lineDivider {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return group
+	}
+
+	repaired := make([]classifiedLine, 0, len(group)+2)
+	switch group[0].typ {
+	case lineContent:
+		repaired = append(repaired, restyleBorder(group[first], lineTopBorder))
+		repaired = append(repaired, group...)
+	case lineDivider:
+		repaired = append(repaired, restyleBorder(group[0], lineTopBorder))
+		repaired = append(repaired, group[1:]...)
+	default:
+		repaired = append(repaired, group...)
+	}
+
+	n := len(repaired)
+	switch repaired[n-1].typ {
+	case lineContent:
+		repaired = append(repaired, restyleBorder(group[last], lineBottomBorder))
+	case lineDivider:
+		if n > 1 {
+			repaired[n-1] = restyleBorder(repaired[n-1], lineBottomBorder)
+		}
+	}
+
+	return repaired
+}
+
+// restyleBorder returns a border line of the given type with the same
+// junction positions as cl.
+func restyleBorder(cl classifiedLine, typ lineType) classifiedLine {
+	var chars borderChars
+	switch typ {
+	case lineTopBorder:
+		chars = getTopBorderChars(cl)
+	case lineBottomBorder:
+		chars = getBottomBorderChars(cl)
+	default:
+		chars = getDividerChars(cl)
+	}
+
+	runes := []rune(cl.trimmed)
+	out := make([]rune, len(runes))
+	for i, r := range runes {
+		switch {
+		case i == 0:
+			out[i] = chars.left
+		case i == len(runes)-1:
+			out[i] = chars.right
+		case isJunction(r):
+			out[i] = chars.junction
+		default:
+			out[i] = chars.horizontal
+		}
+	}
+
+	cl.typ = typ
+	cl.trimmed = string(out)
+	return cl
+}
+
 func isValidBox(group []classifiedLine) bool {
 	if len(group) < 2 {
 		return false
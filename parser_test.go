@@ -20,6 +20,10 @@ func TestClassifyLine(t *testing.T) {
 		{"└────┴────┘", lineBottomBorder},
 		{"├────┼────┤", lineDivider},
 
+		// Dividers around merged cells
+		{"├────┴────┤", lineDivider},
+		{"├────┬────┤", lineDivider},
+
 		// ASCII borders
 		{"+--------+", lineTopBorder},
 		{"+----+----+", lineTopBorder},
@@ -79,7 +83,7 @@ func TestDetectBoxRegions(t *testing.T) {
 		"more text",
 	}
 	classified := classifyLines(lines)
-	regions := detectBoxRegions(classified)
+	regions := detectBoxRegions(classified, defaultOptions())
 
 	if len(regions) != 1 {
 		t.Fatalf("expected 1 region, got %d", len(regions))
@@ -102,7 +106,7 @@ func TestDetectBoxRegionsMultiple(t *testing.T) {
 		"└──┘",
 	}
 	classified := classifyLines(lines)
-	regions := detectBoxRegions(classified)
+	regions := detectBoxRegions(classified, defaultOptions())
 
 	if len(regions) != 2 {
 		t.Fatalf("expected 2 regions, got %d", len(regions))
@@ -117,7 +121,7 @@ func TestDetectBoxRegionsInvalid(t *testing.T) {
 		"plain text",
 	}
 	classified := classifyLines(lines)
-	regions := detectBoxRegions(classified)
+	regions := detectBoxRegions(classified, defaultOptions())
 
 	if len(regions) != 0 {
 		t.Fatalf("expected 0 regions, got %d", len(regions))
@@ -135,3 +139,45 @@ func TestCommonIndent(t *testing.T) {
 		t.Errorf("commonIndent = %q, want %q", got, "  ")
 	}
 }
+
+func TestDetectBoxRegionsRepair(t *testing.T) {
+	repair := defaultOptions()
+	repair.repair = true
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  int
+	}{
+		{"missing bottom", []string{"┌──┐", "│ A│", "plain text"}, 3},
+		{"missing top", []string{"│ A│", "└──┘"}, 3},
+		{"missing right edge", []string{"┌──┐", "│ A", "└──┘"}, 3},
+		{"open border", []string{"┌──", "│ A│", "└──┘"}, 3},
+		{"leading divider", []string{"├──┤", "│ A│", "└──┘"}, 3},
+	}
+	for _, tt := range tests {
+		regions := detectBoxRegions(classifyLines(tt.lines), repair)
+		if len(regions) != 1 {
+			t.Errorf("%s: expected 1 region, got %d", tt.name, len(regions))
+			continue
+		}
+		if got := len(regions[0].lines); got != tt.want {
+			t.Errorf("%s: region has %d lines, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDetectBoxRegionsRepairIgnoresTables(t *testing.T) {
+	repair := defaultOptions()
+	repair.repair = true
+
+	lines := []string{
+		"| col1 | col2 |",
+		"| ---- | ---- |",
+		"| a    | b",
+	}
+	regions := detectBoxRegions(classifyLines(lines), repair)
+	if len(regions) != 0 {
+		t.Fatalf("expected 0 regions, got %d", len(regions))
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// drawBox draws rows of cell texts as a box in opts.style. With header set,
+// a divider separates the first row from the rest. When opts.maxWidth is
+// too narrow for the cells they are wrapped, and every row is then
+// separated by a divider so that wrapped lines stay visibly grouped.
+func drawBox(indent string, rows [][]string, header bool, align []alignment, opts options) []string {
+	numCols := 0
+	for _, row := range rows {
+		numCols = max(numCols, len(row))
+	}
+	if numCols == 0 {
+		return nil
+	}
+
+	ascii := opts.style == styleASCII
+	vertical := "│"
+	if ascii {
+		vertical = "|"
+	}
+
+	widths := make([]int, numCols)
+	for _, row := range rows {
+		for c, text := range row {
+			for _, line := range strings.Split(text, "\n") {
+				widths[c] = max(widths[c], stringWidth(line))
+			}
+		}
+	}
+	wrapped := false
+	if opts.maxWidth > 0 {
+		widths, wrapped = fitWidths(widths, opts.maxWidth-stringWidth(indent), opts)
+	}
+
+	region := boxRegion{indent: indent}
+	table := boxTable{numCols: numCols, align: align}
+	for len(table.align) < numCols {
+		table.align = append(table.align, alignDefault)
+	}
+	allActive := make([]bool, numCols-1)
+	for k := range allActive {
+		allActive[k] = true
+	}
+	addLine := func(typ lineType, cells []cell) {
+		cl := classifiedLine{typ: typ, isASCII: ascii}
+		if typ == lineContent {
+			cl.trimmed = vertical + vertical
+		}
+		region.lines = append(region.lines, cl)
+		table.cells = append(table.cells, cells)
+		table.active = append(table.active, allActive)
+	}
+
+	addLine(lineTopBorder, nil)
+	for r, row := range rows {
+		if r > 0 && wrapped && !(header && r == 1) {
+			addLine(lineDivider, nil)
+		}
+
+		cellLines := make([][]string, numCols)
+		height := 1
+		for c := range cellLines {
+			text := ""
+			if c < len(row) {
+				text = row[c]
+			}
+			for _, line := range strings.Split(text, "\n") {
+				cellLines[c] = append(cellLines[c], wrapText(line, widths[c])...)
+			}
+			height = max(height, len(cellLines[c]))
+		}
+
+		for l := 0; l < height; l++ {
+			cells := make([]cell, numCols)
+			for c := range cells {
+				cells[c] = cell{col: c, span: 1}
+				if l < len(cellLines[c]) {
+					cells[c].text = cellLines[c][l]
+				}
+			}
+			addLine(lineContent, cells)
+		}
+		// The header is set apart even when no rows follow it
+		if header && r == 0 {
+			addLine(lineDivider, nil)
+		}
+	}
+	addLine(lineBottomBorder, nil)
+
+	return renderBoxTable(region, table, opts)
+}
+
+// fitWidths narrows the widest columns until a box with the given column
+// widths fits in maxWidth, and reports whether any column was narrowed.
+// Cells are padded as set in opts. Columns are never narrowed below one
+// character.
+func fitWidths(widths []int, maxWidth int, opts options) ([]int, bool) {
+	fitted := append([]int(nil), widths...)
+	narrowed := false
+	for boxWidth(fitted, opts) > maxWidth {
+		widest := 0
+		for c, w := range fitted {
+			if w > fitted[widest] {
+				widest = c
+			}
+		}
+		if fitted[widest] <= 1 {
+			break
+		}
+		fitted[widest]--
+		narrowed = true
+	}
+	return fitted, narrowed
+}
+
+// readRecords reads CSV, or TSV when comma is '\t'. Records may have
+// different numbers of fields. TSV has no quoting, so quotes in TSV fields
+// are kept as they are.
+func readRecords(r io.Reader, comma rune) ([][]string, error) {
+	if comma == '\t' {
+		var records [][]string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			line := strings.TrimSuffix(scanner.Text(), "\r")
+			records = append(records, strings.Split(line, "\t"))
+		}
+		return records, scanner.Err()
+	}
+
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	return reader.ReadAll()
+}
+
+// escapeCellText escapes the vertical bars in text so that they are not
+// taken for column separators once the text is drawn in a box.
+func escapeCellText(text string) string {
+	text = strings.ReplaceAll(text, "|", `\|`)
+	return strings.ReplaceAll(text, "│", `\│`)
+}
+
+// runRender implements the render subcommand, which draws CSV or TSV data
+// as a box.
+func runRender(args []string) int {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	format := fs.String("format", "", "input format: csv or tsv (default: from the file extension, else csv)")
+	header := fs.Bool("header", true, "draw a divider below the first record")
+	style := fs.String("style", "unicode", "box style: unicode or ascii")
+	align := fs.String("align", "", "comma-separated column alignments (left, center, right)")
+	maxWidth := fs.Int("max-width", 0, "wrap cells so the box fits in this many columns (0 for no limit)")
+	output := fs.String("o", "", "output file path")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: boxfmt render [options] [file]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := defaultOptions()
+	var err error
+	if opts.style, err = parseStyle(*style); err != nil {
+		fmt.Fprintf(os.Stderr, "error: -style: %v\n", err)
+		return 1
+	}
+	aligns, err := parseAlignments(*align)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: -align: %v\n", err)
+		return 1
+	}
+	opts.maxWidth = *maxWidth
+
+	in := io.Reader(os.Stdin)
+	if fs.NArg() > 0 {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+		if *format == "" && strings.EqualFold(filepath.Ext(fs.Arg(0)), ".tsv") {
+			*format = "tsv"
+		}
+	}
+
+	comma := ','
+	switch strings.ToLower(*format) {
+	case "", "csv":
+	case "tsv":
+		comma = '\t'
+	default:
+		fmt.Fprintf(os.Stderr, "error: -format: unknown format %q\n", *format)
+		return 1
+	}
+
+	records, err := readRecords(in, comma)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	for _, record := range records {
+		for i, field := range record {
+			record[i] = escapeCellText(field)
+		}
+	}
+
+	lines := drawBox("", records, *header, aligns, opts)
+	result := ""
+	if len(lines) > 0 {
+		result = strings.Join(lines, "\n") + "\n"
+	}
+
+	if *output != "" {
+		if err := os.WriteFile(*output, []byte(result), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fmt.Print(result)
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDrawBox(t *testing.T) {
+	rows := [][]string{{"name", "説明"}, {"a", "テスト"}, {"bob", ""}}
+
+	got := strings.Join(drawBox("", rows, true, nil, defaultOptions()), "\n")
+	want := strings.Join([]string{
+		"┌──────┬────────┐",
+		"│ name │ 説明   │",
+		"├──────┼────────┤",
+		"│ a    │ テスト │",
+		"│ bob  │        │",
+		"└──────┴────────┘",
+	}, "\n")
+	if got != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+
+	ascii := defaultOptions()
+	ascii.style = styleASCII
+	got = strings.Join(drawBox("  ", rows[1:], false, []alignment{alignRight}, ascii), "\n")
+	want = strings.Join([]string{
+		"  +-----+--------+",
+		"  |   a | テスト |",
+		"  | bob |        |",
+		"  +-----+--------+",
+	}, "\n")
+	if got != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestDrawBoxMaxWidth(t *testing.T) {
+	opts := defaultOptions()
+	opts.maxWidth = 20
+	rows := [][]string{{"k", "v"}, {"a", "one two three four"}, {"b", "x"}}
+
+	got := strings.Join(drawBox("", rows, true, nil, opts), "\n")
+	want := strings.Join([]string{
+		"┌───┬────────────┐",
+		"│ k │ v          │",
+		"├───┼────────────┤",
+		"│ a │ one two    │",
+		"│   │ three four │",
+		"├───┼────────────┤",
+		"│ b │ x          │",
+		"└───┴────────────┘",
+	}, "\n")
+	if got != want {
+		t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+	}
+}
+
+func TestFitWidths(t *testing.T) {
+	opts := defaultOptions()
+	got, narrowed := fitWidths([]int{3, 10, 5}, 20, opts)
+	if !narrowed || got[0] != 3 {
+		t.Errorf("fitWidths = %v, %v", got, narrowed)
+	}
+	if total := boxWidth(got, opts); total > 20 {
+		t.Errorf("fitted box is %d wide, want at most 20", total)
+	}
+
+	if _, narrowed := fitWidths([]int{3, 4}, 80, opts); narrowed {
+		t.Error("fitWidths narrowed columns that already fit")
+	}
+}
+
+func TestReadRecords(t *testing.T) {
+	records, err := readRecords(strings.NewReader("a,\"b, c\"\nd\n"), ',')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[0]) != 2 || records[0][1] != "b, c" || len(records[1]) != 1 {
+		t.Errorf("readRecords CSV = %q", records)
+	}
+
+	records, err = readRecords(strings.NewReader("a\t\"b\tc\n"), '\t')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || len(records[0]) != 3 || records[0][1] != `"b` {
+		t.Errorf("readRecords TSV = %q", records)
+	}
+}
+
+func TestEscapeCellText(t *testing.T) {
+	text := escapeCellText("ls | wc │ x")
+	if text != `ls \| wc \│ x` {
+		t.Errorf("escapeCellText = %q", text)
+	}
+
+	got := splitContentColumns("│ "+text+" │ y │", 2)
+	if len(got) != 2 || got[0] != text {
+		t.Errorf("escaped text was split: %q", got)
+	}
+}
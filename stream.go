@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+// formatStream formats the text read from r and writes the result to w as
+// it goes. Only the current group of lines that may belong to a box or
+// Markdown table is held in memory; every other line is written as soon as
+// it is read. A byte order mark and each line's ending are kept. Text in
+// opts.encoding is decoded before it is classified and encoded again when
+// written. A line that is not valid text stops formatting with a
+// diagnostic as the error.
+//
+// A line that is plain and has no pipe cannot be part of a box or table, so
+// the lines between two such lines are formatted on their own with
+// formatContent. Such a segment is split further wherever no box, table or
+// group of boxes can span the split, so that long runs of lines with pipes
+// are not held. When boxes are drawn uniformly, connector lines such as
+// blank lines and arrows are kept with the segment before them, so that a
+// group of consecutive boxes is formatted together. The lines of a fenced
+// code block are held only until the block holds more than one box and
+// blank lines, since a box converted to a Markdown table takes the place of
+// a block holding nothing else.
+func formatStream(r io.Reader, w io.Writer, opts options) ([]diagnostic, error) {
+	in := bufio.NewReader(r)
+	var encoder io.WriteCloser
+	if opts.encoding != "" {
+		in, encoder = transcode(opts.encoding, in, w)
+		w = encoder
+	}
+	out := bufio.NewWriter(w)
+	if bom, _ := in.Peek(len(byteOrderMark)); string(bom) == byteOrderMark {
+		in.Discard(len(bom))
+		out.WriteString(byteOrderMark)
+	}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), math.MaxInt)
+	scanner.Split(scanLinesWithNewline)
+	// Unfixed lines keep their tabs, as in formatContent
+	keepTabs := opts.indentTabs || opts.lines != nil
+
+	var diags []diagnostic
+	var s segment
+
+	// dir is the directive on the last non-blank line, if any
+	var dir string
+	dirLine := -1
+	// block is the code block the current line is in, if any
+	var block fencedBlock
+	var prev streamLine
+
+	for i := 0; scanner.Scan(); i++ {
+		raw := scanner.Text()
+		if err := checkText(raw, opts.encoding); err != nil {
+			return diags, diagnostic{line: i, message: err.Error()}
+		}
+		line, newline := strings.CutSuffix(raw, "\n")
+		ending := "\n"
+		if trimmed, ok := strings.CutSuffix(line, "\r"); ok && newline {
+			line, ending = trimmed, "\r\n"
+		}
+		expanded := expandTabs(line, opts.tabWidth)
+		cur := describeLine(expanded, prev, opts)
+		split := len(s.lines) > 0 && s.splits(prev, cur, block)
+
+		open := block.fence
+		inBlock := open != ""
+		if inBlock {
+			if closesFence(expanded, open) {
+				block = fencedBlock{}
+			} else {
+				block.add(prev, cur)
+			}
+		} else if fence, ok := openingFence(expanded); ok {
+			block, inBlock = fencedBlock{fence: fence}, true
+		}
+		prev = cur
+
+		if inBlock || !cur.boundary() {
+			if split {
+				diags = append(diags, s.format(out, opts)...)
+				s.lines = s.lines[:0]
+			}
+			if len(s.lines) == 0 {
+				s = segment{start: i, lines: s.lines, fence: open, dir: dir, dirLine: dirLine}
+				d, _ := parseDirective(dir)
+				s.uniform = opts.uniform || d.has("uniform")
+			}
+			s.lines = append(s.lines, raw)
+			dir, dirLine = "", -1
+			continue
+		}
+
+		if len(s.lines) > 0 && s.uniform && isConnector(line) {
+			s.lines = append(s.lines, raw)
+			continue
+		}
+		if len(s.lines) > 0 {
+			diags = append(diags, s.format(out, opts)...)
+			s.lines = s.lines[:0]
+		}
+		if !keepTabs {
+			line = expanded
+		}
+		out.WriteString(line)
+		if newline {
+			out.WriteString(ending)
+		}
+		if strings.TrimSpace(line) != "" {
+			dir, dirLine = "", -1
+			if _, ok := parseDirective(line); ok {
+				dir, dirLine = line, i
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return diags, err
+	}
+	if len(s.lines) > 0 {
+		diags = append(diags, s.format(out, opts)...)
+	}
+	if err := out.Flush(); err != nil || encoder == nil {
+		return diags, err
+	}
+	return diags, encoder.Close()
+}
+
+// segment is a run of lines, each with its line ending except possibly the
+// last, that may hold boxes or tables. fence opened the code block the
+// segment starts in, if it starts after the block's opening fence. dir is
+// the directive before the lines and dirLine its index, or -1 if there is
+// none. uniform is set when the segment's boxes may be drawn uniformly.
+type segment struct {
+	start   int
+	lines   []string
+	fence   string
+	dir     string
+	dirLine int
+	uniform bool
+}
+
+// splits reports whether the segment can be formatted without the line cur
+// that follows it. A box is a run of lines that are not plain, a table
+// runs from its header row to its last row, and a group of boxes drawn
+// uniformly is only broken by a plain line that is not a connector. Within
+// a code block, the segment is only split before text once the block holds
+// more than a box, so that a box first in the block, or the only thing in
+// it, is formatted with the block's opening fence and the directive before
+// it.
+func (s segment) splits(prev, cur streamLine, block fencedBlock) bool {
+	switch {
+	case !prev.plain && !cur.plain:
+		return false
+	case prev.row && cur.delimiter, prev.table && cur.row:
+		return false
+	case s.uniform && !prev.separatesBoxes() && !cur.separatesBoxes():
+		return false
+	case block.fence != "":
+		return block.mixed && cur.plain && !cur.blank
+	}
+	return true
+}
+
+// format writes the formatted segment to w and returns its diagnostics.
+// The directive, or the fence of the code block the segment starts in, is
+// passed along as the segment's first line and then dropped from the
+// output.
+func (s segment) format(w io.StringWriter, opts options) []diagnostic {
+	var content strings.Builder
+	offset := s.start
+	// A segment starting in a code block has no directive before it
+	if s.fence != "" {
+		content.WriteString(s.fence + "\n")
+		offset--
+	}
+	if s.dirLine >= 0 {
+		content.WriteString(s.dir + "\n")
+		offset--
+	}
+	for _, line := range s.lines {
+		content.WriteString(line)
+	}
+
+	if opts.lines != nil {
+		end := s.start + len(s.lines)
+		lines := make([]lineRange, 0, 1)
+		for _, r := range opts.lines {
+			if r.start < end && s.start < r.end {
+				lines = append(lines, lineRange{start: r.start - offset, end: r.end - offset})
+			}
+		}
+		opts.lines = lines
+	}
+
+	result := formatContent(content.String(), opts)
+	text := result.text
+	if s.fence != "" || s.dirLine >= 0 {
+		_, text, _ = strings.Cut(text, "\n")
+	}
+	w.WriteString(text)
+
+	for i, d := range result.diags {
+		if s.dirLine >= 0 && d.line == 0 {
+			result.diags[i].line = s.dirLine
+		} else {
+			result.diags[i].line += offset
+		}
+	}
+	return result.diags
+}
+
+// streamLine is what formatStream knows of a line when deciding where to
+// split a segment.
+type streamLine struct {
+	plain     bool // cannot be part of a box
+	blank     bool
+	connector bool
+	row       bool // a Markdown table row
+	delimiter bool // a Markdown table delimiter row
+	table     bool // a row of a table, from its delimiter row on
+}
+
+func describeLine(line string, prev streamLine, opts options) streamLine {
+	cl := classifyLine(line)
+	if opts.repair && cl.typ == linePlain {
+		cl = classifyOpenLine(cl)
+	}
+	l := streamLine{
+		plain:     cl.typ == linePlain,
+		blank:     strings.TrimSpace(line) == "",
+		connector: isConnector(line),
+		row:       splitMarkdownRow(line) != nil,
+	}
+	_, l.delimiter = parseDelimiterRow(line)
+	l.table = l.row && (prev.table || prev.row && l.delimiter)
+	return l
+}
+
+// boundary reports whether the line can be neither part of a box nor a row
+// of a Markdown table.
+func (l streamLine) boundary() bool {
+	return l.plain && !l.row
+}
+
+// separatesBoxes reports whether the line ends a group of boxes drawn
+// uniformly.
+func (l streamLine) separatesBoxes() bool {
+	return l.plain && !l.connector
+}
+
+// fencedBlock is a code block being read: fence opened it, box is set once
+// it holds a box, and mixed once it holds anything more than one box and
+// blank lines.
+type fencedBlock struct {
+	fence string
+	box   bool
+	mixed bool
+}
+
+// add records line cur of the block's content, which follows prev.
+func (b *fencedBlock) add(prev, cur streamLine) {
+	switch {
+	case cur.blank:
+	case cur.plain, b.box && prev.plain:
+		b.mixed = true
+	default:
+		b.box = true
+	}
+}
+
+// scanLinesWithNewline is a bufio.SplitFunc like bufio.ScanLines that keeps
+// the newline at the end of each line, so the last line's is not lost.
+func scanLinesWithNewline(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i+1], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// formatFile streams the file at path through the formatter into w.
+func formatFile(path string, w io.Writer, opts options) ([]diagnostic, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return formatStream(f, w, opts)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const streamInput = "# Title\n" +
+	"\n" +
+	"<!-- boxfmt: table -->\n" +
+	"\n" +
+	"┌──┬──┐\n│ a │ bb │\n├──┼──┤\n│ 1 │ 2 │\n└──┴──┘\n" +
+	"\n" +
+	"┌─┐\n│ not a table │\n└─┘\n" +
+	"text | with a pipe\n" +
+	"\t┌─┐\n\t│ tabbed │\n\t└─┘\n" +
+	"<!-- boxfmt: bogus -->\n" +
+	"| x | y |\n|---|--:|\n| 1 | 22 |\n" +
+	"\n" +
+	"+--+\n| ascii |\n+--+\n" +
+	"```\nINFO | a | b\n┌──┬──┐\n│ in │ block │\n└──┴──┘\n```\n" +
+	"~~~\n\n┌──┬──┐\n│ only │ box │\n└──┴──┘\n~~~"
+
+func TestFormatStreamMatchesFormatContent(t *testing.T) {
+	tests := map[string]func(*options){
+		"default":     func(*options) {},
+		"indent tabs": func(o *options) { o.indentTabs = true },
+		"lines":       func(o *options) { o.lines = []lineRange{{start: 11, end: 12}, {start: 22, end: 23}} },
+		"no lines":    func(o *options) { o.lines = []lineRange{} },
+		"from table":  func(o *options) { o.fromTable = true },
+		"to table":    func(o *options) { o.toTable = true },
+	}
+	for name, configure := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts := defaultOptions()
+			configure(&opts)
+			want := formatContent(streamInput, opts)
+
+			var b strings.Builder
+			diags, err := formatStream(iotest.OneByteReader(strings.NewReader(streamInput)), &b, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != want.text {
+				t.Errorf("got:\n%s\nwant:\n%s", b.String(), want.text)
+			}
+			if !reflect.DeepEqual(diags, want.diags) {
+				t.Errorf("diagnostics %v, want %v", diags, want.diags)
+			}
+		})
+	}
+}
+
+func TestFormatStreamDirectiveOnlyForNextBox(t *testing.T) {
+	input := "<!-- boxfmt: table -->\n┌─┐\n│ a │\n└─┘\n\n┌──┬──┐\n│ a │ b │\n└──┴──┘\n"
+	got, _ := processFile(input, defaultOptions())
+	if !strings.Contains(got, "┌───┬───┐") {
+		t.Errorf("second box was converted by the first box's directive:\n%s", got)
+	}
+}
+
+func TestFormatStreamDiagnosticLines(t *testing.T) {
+	input := "text\n<!-- boxfmt: bogus -->\n\n┌──┬──┐\n│ a │ b │ c │\n└──┴──┘\n"
+	_, diags := processFile(input, defaultOptions())
+	var lines []int
+	for _, d := range diags {
+		lines = append(lines, d.line)
+	}
+	if want := []int{1, 4}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("diagnostic lines %v, want %v (%v)", lines, want, diags)
+	}
+}
+
+// lagReader serves head and then n copies of line, and records how many of
+// the lines served at most had not been written to out yet.
+type lagReader struct {
+	head, line string
+	n          int
+	pending    string
+	served     int
+	out        strings.Builder
+	lag        int
+}
+
+func (r *lagReader) Read(p []byte) (int, error) {
+	if r.pending == "" {
+		switch {
+		case r.head != "":
+			r.pending, r.head = r.head, ""
+		case r.served < r.n:
+			r.pending = r.line
+			r.served++
+		default:
+			return 0, io.EOF
+		}
+	}
+	r.lag = max(r.lag, r.served-strings.Count(r.out.String(), r.line))
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func TestFormatStreamDoesNotHoldLines(t *testing.T) {
+	line := "INFO | " + strings.Repeat("x", 5000) + " | 200 OK\n"
+	for name, head := range map[string]string{
+		"pipes":      "",
+		"code block": "```\n┌─┐\n│ a │\n└─┘\n",
+		"uniform":    "<!-- boxfmt: uniform -->\n┌─┐\n│ a │\n└─┘\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := &lagReader{head: head, line: line, n: 100}
+			if _, err := formatStream(r, &r.out, defaultOptions()); err != nil {
+				t.Fatal(err)
+			}
+			// The line being read, the one before it and the part of one
+			// still in the output buffer
+			if r.lag > 3 {
+				t.Errorf("%d lines were held before being written", r.lag)
+			}
+		})
+	}
+}
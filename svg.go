@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// Geometry of the monospace grid that boxes are drawn on. One grid column
+// is one display column, so CJK characters take two.
+const (
+	svgCellWidth  = 9
+	svgLineHeight = 20
+	svgFontSize   = 15
+)
+
+// renderSVG draws a parsed box as an SVG image. Each line of the box is a
+// grid row; borders are drawn through the middle of their rows and text is
+// stretched to exactly its display width so columns stay aligned whatever
+// the font's CJK glyph widths are.
+func renderSVG(region boxRegion, table boxTable) string {
+	opts := defaultOptions()
+	widths := columnWidths(table.cells, table.numCols, opts)
+
+	// edges[c] is the grid column of the vertical line left of column c;
+	// edges[numCols] is the right edge.
+	edges := make([]int, table.numCols+1)
+	for c, w := range widths {
+		edges[c+1] = edges[c] + w + 3
+	}
+	cols := edges[table.numCols] + 1
+	rows := len(region.lines)
+
+	x := func(col int) float64 { return (float64(col) + 0.5) * svgCellWidth }
+	y := func(row int) float64 { return (float64(row) + 0.5) * svgLineHeight }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		cols*svgCellWidth, rows*svgLineHeight, cols*svgCellWidth, rows*svgLineHeight)
+
+	b.WriteString(`<g fill="none" stroke="currentColor" stroke-width="1">` + "\n")
+	fmt.Fprintf(&b, `<rect x="%g" y="%g" width="%g" height="%g"/>`+"\n", x(0), y(0), x(cols-1)-x(0), y(rows-1)-y(0))
+	upper := 0
+	for i, cl := range region.lines {
+		if cl.typ == lineContent {
+			continue
+		}
+		if cl.typ == lineDivider {
+			fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g"/>`+"\n", x(0), y(i), x(cols-1), y(i))
+		}
+		if i > 0 {
+			for k, on := range table.active[upper] {
+				if on {
+					fmt.Fprintf(&b, `<line x1="%g" y1="%g" x2="%g" y2="%g"/>`+"\n", x(edges[k+1]), y(upper), x(edges[k+1]), y(i))
+				}
+			}
+		}
+		upper = i
+	}
+	b.WriteString("</g>\n")
+
+	fmt.Fprintf(&b, `<g fill="currentColor" font-family="monospace" font-size="%d" dominant-baseline="central" xml:space="preserve">`+"\n", svgFontSize)
+	for i, cells := range table.cells {
+		for _, c := range cells {
+			padded := fillAligned(c.text, spanWidth(widths, c, opts.cellGap()), table.align[c.col])
+			text := strings.TrimLeft(padded, " ")
+			offset := len(padded) - len(text)
+			text = strings.TrimRight(text, " ")
+			if text == "" {
+				continue
+			}
+			col := edges[c.col] + 2 + offset
+			fmt.Fprintf(&b, `<text x="%g" y="%g" textLength="%g" lengthAdjust="spacingAndGlyphs">%s</text>`+"\n",
+				float64(col*svgCellWidth), y(i), float64(stringWidth(text)*svgCellWidth), xmlEscape(text))
+		}
+	}
+	b.WriteString("</g>\n</svg>\n")
+
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestRenderSVG(t *testing.T) {
+	lines := []string{
+		"┌──┬──┐",
+		"│ 日本│ a<b │",
+		"├──┴──┤",
+		"│ merged │",
+		"└─────┘",
+	}
+	region := detectBoxRegions(classifyLines(lines), defaultOptions())[0]
+	table, err := parseBox(region, defaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	svg := renderSVG(region, table)
+	if err := xml.Unmarshal([]byte(svg), new(struct{})); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, svg)
+	}
+
+	// │ 日本 │ a<b │ spans 14 grid columns and the box has 5 lines
+	if !strings.Contains(svg, `width="126" height="100"`) {
+		t.Errorf("unexpected size:\n%s", svg)
+	}
+	// 日本 is two wide characters, stretched to four grid columns
+	if !strings.Contains(svg, `<text x="18" y="30" textLength="36" lengthAdjust="spacingAndGlyphs">日本</text>`) {
+		t.Errorf("CJK text not placed on the grid:\n%s", svg)
+	}
+	if !strings.Contains(svg, "a&lt;b") {
+		t.Errorf("text not escaped:\n%s", svg)
+	}
+	// The inner boundary only runs through the first section
+	if strings.Count(svg, `<line x1="67.5"`) != 1 {
+		t.Errorf("expected one inner vertical line:\n%s", svg)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// uniformWidths draws each group of consecutive boxes as wide as the widest
+// of them, and gives the boxes of a group with as many columns the same
+// column widths. Boxes are consecutive when only connector lines lie
+// between them. A group is drawn uniformly when the options of its first
+// box have uniform set; fixOpts holds the options of each fix and is
+// updated in place.
+func uniformWidths(lines []string, fixes []regionFix, fixOpts []options) {
+	for start := 0; start < len(fixes); {
+		end := start + 1
+		for end < len(fixes) && fixes[end-1].widths != nil && fixes[end].widths != nil &&
+			allConnectors(lines[fixes[end-1].endIdx:fixes[end].startIdx]) {
+			end++
+		}
+		if fixOpts[start].uniform && end-start > 1 {
+			alignGroup(fixes[start:end], fixOpts[start:end])
+		}
+		start = end
+	}
+}
+
+// alignGroup sets the width and column widths of a group of boxes. Boxes
+// wrapped to fit maxWidth are measured again at the group's widths, at
+// which they may wrap further.
+func alignGroup(fixes []regionFix, fixOpts []options) {
+	aligned := groupWidths(fixes, fixOpts, fixOpts)
+	if slices.ContainsFunc(fixOpts, func(o options) bool { return o.maxWidth > 0 }) {
+		aligned = groupWidths(fixes, aligned, fixOpts)
+	}
+	copy(fixOpts, aligned)
+}
+
+// groupWidths returns base with the width and column widths of a group of
+// boxes, each measured with its options in measure.
+func groupWidths(fixes []regionFix, measure, base []options) []options {
+	widths := make([][]int, len(fixes))
+	columns := make(map[int][]int)
+	for i, f := range fixes {
+		widths[i] = f.widths(measure[i])
+		n := len(widths[i])
+		if n == 0 {
+			continue
+		}
+		if columns[n] == nil {
+			columns[n] = make([]int, n)
+		}
+		for c, w := range widths[i] {
+			columns[n][c] = max(columns[n][c], w)
+		}
+	}
+
+	total := 0
+	for i, ws := range widths {
+		if ws != nil {
+			total = max(total, boxWidth(columns[len(ws)], base[i]))
+		}
+	}
+	aligned := slices.Clone(base)
+	for i, ws := range widths {
+		if ws != nil {
+			aligned[i].columnWidths = columns[len(ws)]
+			aligned[i].width = max(base[i].width, total)
+		}
+	}
+	return aligned
+}
+
+// boxColumnWidths returns the content width of each column of the box in
+// region as it is drawn with opts, wrapped to fit opts.maxWidth, or nil if
+// it cannot be drawn.
+func boxColumnWidths(region boxRegion, opts options) []int {
+	layout := detectColumns(region)
+	if len(layout.separators) == 0 {
+		_, width, _ := wrapSingleColumn(region, opts)
+		return []int{width}
+	}
+	table, err := parseBoxTable(region, layout, opts)
+	if err != nil {
+		return nil
+	}
+	if opts.maxWidth > 0 {
+		region, table, opts = wrapBoxTable(region, table, opts)
+	}
+	return columnWidths(table.cells, table.numCols, opts)
+}
+
+// allConnectors reports whether every line may lie between two boxes of a
+// group: blank lines and lines of symbols only, such as arrows.
+func allConnectors(lines []string) bool {
+	for _, line := range lines {
+		if !isConnector(line) {
+			return false
+		}
+	}
+	return true
+}
+
+func isConnector(line string) bool {
+	return !strings.ContainsFunc(line, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	})
+}
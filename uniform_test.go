@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUniform(t *testing.T) {
+	uniform := defaultOptions()
+	uniform.uniform = true
+	wrapped := uniform
+	wrapped.maxWidth = 13
+
+	tests := []struct {
+		name  string
+		opts  options
+		input []string
+		want  []string
+	}{
+		{
+			name:  "connected by arrows",
+			opts:  uniform,
+			input: []string{"┌─┐", "│ Parse │", "└─┘", "", "   ↓", "", "┌─┐", "│ Transform │", "└─┘"},
+			want:  []string{"┌───────────┐", "│ Parse     │", "└───────────┘", "", "   ↓", "", "┌───────────┐", "│ Transform │", "└───────────┘"},
+		},
+		{
+			name:  "columns",
+			opts:  uniform,
+			input: []string{"┌─┬─┐", "│ a │ 10 │", "└─┴─┘", "", "┌─┬─┐", "│ name │ 1 │", "└─┴─┘", "", "┌─┐", "│ x │", "└─┘"},
+			want: []string{
+				"┌──────┬────┐", "│ a    │ 10 │", "└──────┴────┘", "",
+				"┌──────┬────┐", "│ name │ 1  │", "└──────┴────┘", "",
+				"┌───────────┐", "│ x         │", "└───────────┘",
+			},
+		},
+		{
+			name:  "wrapped",
+			opts:  wrapped,
+			input: []string{"┌─┐", "│ much too wide │", "└─┘", "", "┌─┬─┐", "│ a │ one two │", "└─┴─┘", "", "┌─┐", "│ x │", "└─┘"},
+			want: []string{
+				"┌──────────┐", "│ much too │", "│ wide     │", "└──────────┘", "",
+				"┌───┬──────┐", "│ a │ one  │", "│   │ two  │", "└───┴──────┘", "",
+				"┌──────────┐", "│ x        │", "└──────────┘",
+			},
+		},
+		{
+			name:  "separated by text",
+			opts:  uniform,
+			input: []string{"┌─┐", "│ a │", "└─┘", "then:", "┌─┐", "│ bcd │", "└─┘"},
+			want:  []string{"┌───┐", "│ a │", "└───┘", "then:", "┌─────┐", "│ bcd │", "└─────┘"},
+		},
+		{
+			name:  "directive",
+			opts:  defaultOptions(),
+			input: []string{"<!-- boxfmt: uniform -->", "┌─┐", "│ a │", "└─┘", "", "┌─┐", "│ bcd │", "└─┘", "", "text", "", "┌─┐", "│ a │", "└─┘", "", "┌─┐", "│ bcd │", "└─┘"},
+			want:  []string{"<!-- boxfmt: uniform -->", "┌─────┐", "│ a   │", "└─────┘", "", "┌─────┐", "│ bcd │", "└─────┘", "", "text", "", "┌───┐", "│ a │", "└───┘", "", "┌─────┐", "│ bcd │", "└─────┘"},
+		},
+		{
+			name:  "off",
+			opts:  defaultOptions(),
+			input: []string{"┌─┐", "│ a │", "└─┘", "", "┌─┐", "│ bcd │", "└─┘"},
+			want:  []string{"┌───┐", "│ a │", "└───┘", "", "┌─────┐", "│ bcd │", "└─────┘"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, diags := processFile(strings.Join(tt.input, "\n"), tt.opts)
+			if len(diags) != 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("--- got ---\n%s\n--- want ---\n%s", got, want)
+			}
+			if again, _ := processFile(got, tt.opts); again != got {
+				t.Errorf("uniform boxes are not stable:\n%s", again)
+			}
+		})
+	}
+}
+
+func TestIsConnector(t *testing.T) {
+	for line, want := range map[string]bool{
+		"":       true,
+		"   ↓  ": true,
+		"  ▼":    true,
+		"then:":  false,
+		"step 2": false,
+	} {
+		if got := isConnector(line); got != want {
+			t.Errorf("isConnector(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
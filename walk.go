@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultIncludes are the files formatted when walking a directory
+// without -include or config include globs.
+var defaultIncludes = []string{"*.md", "*.markdown"}
+
+// skippedDirs are never walked into.
+var skippedDirs = map[string]bool{".git": true, ".hg": true, ".svn": true, "node_modules": true}
+
+// globList is a flag that can be repeated, each value holding one or more
+// comma-separated globs.
+type globList []string
+
+func (g *globList) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globList) Set(value string) error {
+	for _, glob := range strings.Split(value, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			*g = append(*g, glob)
+		}
+	}
+	return nil
+}
+
+// fileWalker expands the paths given on the command line into the files to
+// format.
+type fileWalker struct {
+	// include selects the files found in directories, or is nil without
+	// -include; files named on the command line are always included.
+	include []*regexp.Regexp
+
+	// defaults selects the files found in directories without -include or
+	// config include globs.
+	defaults []*regexp.Regexp
+
+	// config returns the config for a file, or nil. Its include globs
+	// select the files found in directories when -include is not given,
+	// and its exclude globs remove them.
+	config func(path string) (*config, error)
+
+	// exclude removes files and whole directories, whether named on the
+	// command line or found in directories.
+	exclude []*regexp.Regexp
+}
+
+func newFileWalker(include, exclude []string) (*fileWalker, error) {
+	w := &fileWalker{}
+	var err error
+	if len(include) > 0 {
+		if w.include, err = compileGlobs(include); err != nil {
+			return nil, fmt.Errorf("-include: %w", err)
+		}
+	}
+	if w.defaults, err = compileGlobs(defaultIncludes); err != nil {
+		return nil, err
+	}
+	if w.exclude, err = compileGlobs(exclude); err != nil {
+		return nil, fmt.Errorf("-exclude: %w", err)
+	}
+	return w, nil
+}
+
+// files returns the files to format in the order given, with each
+// directory expanded into the files below it in lexical order. Errors for
+// individual paths are collected rather than stopping the walk.
+func (w *fileWalker) files(paths []string) ([]string, []error) {
+	files, _, errs := w.expand(paths)
+	return files, errs
+}
+
+// expand is like files, but also returns the directories holding them:
+// every directory walked and the parent of every file named.
+func (w *fileWalker) expand(paths []string) (files, dirs []string, errs []error) {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !info.IsDir() {
+			if !matchAny(w.exclude, filepath.ToSlash(path)) {
+				files = append(files, path)
+				dirs = append(dirs, filepath.Dir(path))
+			}
+			continue
+		}
+
+		found, walked, walkErrs := w.walk(path)
+		files = append(files, found...)
+		dirs = append(dirs, walked...)
+		errs = append(errs, walkErrs...)
+	}
+	return files, dirs, errs
+}
+
+// walk returns the included files below root, skipping those ignored by
+// the .gitignore and .boxfmtignore files in root, in the directories
+// below it, and in the directories above it up to the repository root.
+// It also returns the directories it walked.
+func (w *fileWalker) walk(root string) (files, dirs []string, errs []error) {
+	base, err := parentIgnores(root)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	stacks := map[string]ignoreStack{}
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		stack := base
+		if path != root {
+			stack = stacks[filepath.Dir(path)]
+		}
+		rel := filepath.ToSlash(path)
+
+		if d.IsDir() {
+			if path != root && (skippedDirs[d.Name()] || stack.ignored(abs, true) || matchAny(w.exclude, rel)) {
+				return filepath.SkipDir
+			}
+			if stacks[path], err = stack.push(abs); err != nil {
+				errs = append(errs, err)
+			}
+			dirs = append(dirs, path)
+			return nil
+		}
+
+		if !d.Type().IsRegular() || stack.ignored(abs, false) || matchAny(w.exclude, rel) || !w.included(path, rel) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return files, dirs, errs
+}
+
+// included reports whether a file found in a directory matches -include,
+// or without it the include globs of the file's config, or without those
+// defaultIncludes, and is not excluded by its config. A file whose config
+// cannot be read is included, so that the error is reported when its
+// options are resolved.
+func (w *fileWalker) included(path, rel string) bool {
+	var cfg *config
+	if w.config != nil {
+		var err error
+		if cfg, err = w.config(path); err != nil {
+			return true
+		}
+	}
+	switch {
+	case cfg != nil && cfg.excludes(path):
+		return false
+	case w.include != nil:
+		return matchAny(w.include, rel)
+	case cfg != nil && len(cfg.include) > 0:
+		return matchAny(cfg.include, cfg.rel(path))
+	}
+	return matchAny(w.defaults, rel)
+}
+
+// parentIgnores returns the ignore files in the directories above dir, up
+// to the enclosing repository root. Outside a repository it is empty.
+func parentIgnores(dir string) (ignoreStack, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var parents []string
+	for d := abs; ; {
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			// Not in a repository
+			return nil, nil
+		}
+		d = parent
+		parents = append(parents, d)
+	}
+
+	var stack ignoreStack
+	for i := len(parents) - 1; i >= 0; i-- {
+		if stack, err = stack.push(parents[i]); err != nil {
+			return nil, err
+		}
+	}
+	return stack, nil
+}
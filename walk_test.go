@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestFileWalker(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{
+		"README.md",
+		"notes.txt",
+		"docs/intro.md",
+		"docs/generated/api.md",
+		"docs/drafts/wip.md",
+		"vendor/lib/README.md",
+		"node_modules/pkg/README.md",
+		"site/index.markdown",
+	} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+	writeFile(t, filepath.Join(dir, ".gitignore"), "vendor/\n")
+	writeFile(t, filepath.Join(dir, "docs", ".boxfmtignore"), "generated\n")
+
+	tests := []struct {
+		name    string
+		paths   []string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name:  "defaults",
+			paths: []string{"."},
+			want:  []string{"README.md", "docs/drafts/wip.md", "docs/intro.md", "site/index.markdown"},
+		},
+		{
+			name:    "include and exclude",
+			paths:   []string{"."},
+			include: []string{"*.md", "*.txt"},
+			exclude: []string{"drafts", "site"},
+			want:    []string{"README.md", "docs/intro.md", "notes.txt"},
+		},
+		{
+			// The ignore files above the walked directory still apply
+			name:  "subdirectory",
+			paths: []string{"docs", "vendor"},
+			want:  []string{"docs/drafts/wip.md", "docs/intro.md", "vendor/lib/README.md"},
+		},
+		{
+			// Files named explicitly are not subject to ignore files
+			name:    "explicit files",
+			paths:   []string{"vendor/lib/README.md", "notes.txt", "docs/drafts/wip.md"},
+			exclude: []string{"docs/drafts"},
+			want:    []string{"vendor/lib/README.md", "notes.txt"},
+		},
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := newFileWalker(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, errs := w.files(tt.paths)
+			if len(errs) > 0 {
+				t.Fatal(errs)
+			}
+			for i, f := range files {
+				files[i] = filepath.ToSlash(f)
+			}
+			if !slices.Equal(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileWalkerMissingPath(t *testing.T) {
+	w, err := newFileWalker(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.md"), "")
+
+	files, errs := w.files([]string{filepath.Join(dir, "missing.md"), filepath.Join(dir, "a.md")})
+	if len(errs) != 1 || len(files) != 1 {
+		t.Errorf("files = %v, errs = %v; want one of each", files, errs)
+	}
+}
+
+func TestFileWalkerConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"README.md", "sub/a.txt", "sub/b.go", "other/c.txt"} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+	writeFile(t, filepath.Join(dir, "sub", "skip.md"), "")
+	writeFile(t, filepath.Join(dir, ".boxfmt.toml"), "include = [\"*.txt\", \"*.md\"]\nexclude = [\"skip.md\"]\n")
+	writeFile(t, filepath.Join(dir, "other", ".boxfmt.toml"), "")
+
+	w, err := newFileWalker(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.config = newOptionResolver(nil).config
+	files, errs := w.files([]string{dir})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	// other has a config of its own, without include globs
+	want := []string{filepath.Join(dir, "README.md"), filepath.Join(dir, "sub", "a.txt")}
+	if !slices.Equal(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+
+	// -include takes precedence over the include globs, not the exclude
+	// globs
+	if w, err = newFileWalker([]string{"*.go", "*.md"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	w.config = newOptionResolver(nil).config
+	files, _ = w.files([]string{dir})
+	if want := []string{filepath.Join(dir, "README.md"), filepath.Join(dir, "sub", "b.go")}; !slices.Equal(files, want) {
+		t.Errorf("with -include, files = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits after the last change before
+// formatting, so that editors finish saving before the file is rewritten.
+const watchDebounce = 300 * time.Millisecond
+
+// watcher reformats files in place whenever they change.
+type watcher struct {
+	paths    []string
+	walker   *fileWalker
+	format   func(path string) error
+	debounce time.Duration
+
+	fs      *fsnotify.Watcher
+	files   map[string]bool
+	watched map[string]bool
+	errOut  io.Writer
+}
+
+func newWatcher(paths []string, walker *fileWalker, format func(path string) error) (*watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		paths:    paths,
+		walker:   walker,
+		format:   format,
+		debounce: watchDebounce,
+		fs:       fsw,
+		watched:  make(map[string]bool),
+		errOut:   os.Stderr,
+	}
+	w.refresh()
+	return w, nil
+}
+
+// refresh recomputes the files to format and watches every directory that
+// holds them. Directories are watched rather than files, since editors
+// often save by replacing the file.
+func (w *watcher) refresh() {
+	files, dirs, errs := w.walker.expand(w.paths)
+	for _, err := range errs {
+		fmt.Fprintf(w.errOut, "error: %v\n", err)
+	}
+
+	w.files = make(map[string]bool, len(files))
+	for _, f := range files {
+		w.files[filepath.Clean(f)] = true
+	}
+	for _, d := range dirs {
+		d = filepath.Clean(d)
+		if w.watched[d] {
+			continue
+		}
+		if err := w.fs.Add(d); err != nil {
+			fmt.Fprintf(w.errOut, "error: watch %s: %v\n", d, err)
+			continue
+		}
+		w.watched[d] = true
+	}
+}
+
+// run formats the files that change until ctx is done. Changes are
+// collected until none arrive for the debounce interval.
+func (w *watcher) run(ctx context.Context) error {
+	defer w.fs.Close()
+
+	pending := make(map[string]bool)
+	needRefresh := false
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
+				continue
+			}
+			// New files and directories may need to be formatted or watched
+			if event.Has(fsnotify.Create) {
+				needRefresh = true
+			}
+			pending[filepath.Clean(event.Name)] = true
+			timer.Reset(w.debounce)
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(w.errOut, "error: watch: %v\n", err)
+
+		case <-timer.C:
+			if needRefresh {
+				w.refresh()
+				needRefresh = false
+			}
+			for _, path := range slices.Sorted(maps.Keys(pending)) {
+				if !w.files[path] {
+					continue
+				}
+				if err := w.format(path); err != nil {
+					fmt.Fprintf(w.errOut, "error: %v\n", err)
+				}
+			}
+			clear(pending)
+		}
+	}
+}
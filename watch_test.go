@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	unformatted := "┌──┐\n│ a │\n└──┘\n"
+	formatted := "┌───┐\n│ a │\n└───┘\n"
+	writeFile(t, filepath.Join(dir, "a.md"), "text\n")
+
+	walker, err := newFileWalker(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := newWatcher([]string{dir}, walker, func(path string) error {
+		_, err := rewriteFile(path, defaultOptions(), nil)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.debounce = 20 * time.Millisecond
+	w.errOut = io.Discard
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+
+	waitFor := func(path, want string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			data, _ := os.ReadFile(path)
+			if string(data) == want {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s = %q, want %q", path, data, want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// An existing file is rewritten when it changes
+	writeFile(t, filepath.Join(dir, "a.md"), unformatted)
+	waitFor(filepath.Join(dir, "a.md"), formatted)
+
+	// New directories are watched, and new files in them formatted
+	writeFile(t, filepath.Join(dir, "docs", "b.md"), "")
+	waitFor(filepath.Join(dir, "docs", "b.md"), "")
+	time.Sleep(50 * time.Millisecond)
+	writeFile(t, filepath.Join(dir, "docs", "b.md"), unformatted)
+	waitFor(filepath.Join(dir, "docs", "b.md"), formatted)
+
+	// Files that are not Markdown are left alone
+	writeFile(t, filepath.Join(dir, "notes.txt"), unformatted)
+	time.Sleep(100 * time.Millisecond)
+	if data, _ := os.ReadFile(filepath.Join(dir, "notes.txt")); string(data) != unformatted {
+		t.Errorf("notes.txt rewritten: %q", data)
+	}
+}
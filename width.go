@@ -6,6 +6,23 @@ import (
 	"github.com/mattn/go-runewidth"
 )
 
+// defaultEastAsianWidth is the ambiguous-width setting derived from the
+// locale at startup.
+var defaultEastAsianWidth = runewidth.DefaultCondition.EastAsianWidth
+
+// setAmbiguousWidth sets the width of East Asian Ambiguous characters such
+// as ○ and ※ to 1 or 2. Any other value restores the locale's default.
+func setAmbiguousWidth(width int) {
+	switch width {
+	case 1:
+		runewidth.DefaultCondition.EastAsianWidth = false
+	case 2:
+		runewidth.DefaultCondition.EastAsianWidth = true
+	default:
+		runewidth.DefaultCondition.EastAsianWidth = defaultEastAsianWidth
+	}
+}
+
 func stringWidth(s string) int {
 	return runewidth.StringWidth(s)
 }
@@ -18,6 +35,77 @@ func fillRight(s string, width int) string {
 	return s + strings.Repeat(" ", width-w)
 }
 
+// fillAligned pads s to width, placing it according to align.
+func fillAligned(s string, width int, align alignment) string {
+	gap := width - stringWidth(s)
+	if gap <= 0 {
+		return s
+	}
+	switch align {
+	case alignRight:
+		return strings.Repeat(" ", gap) + s
+	case alignCenter:
+		left := gap / 2
+		return strings.Repeat(" ", left) + s + strings.Repeat(" ", gap-left)
+	}
+	return fillRight(s, width)
+}
+
+// wrapText breaks s into lines no wider than width, at spaces where
+// possible. Words wider than width are broken between characters.
+func wrapText(s string, width int) []string {
+	if width <= 0 || stringWidth(s) <= width {
+		return []string{s}
+	}
+
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	flush := func() {
+		lines = append(lines, strings.TrimRight(line.String(), " "))
+		line.Reset()
+		lineWidth = 0
+	}
+
+	for _, word := range strings.Fields(s) {
+		wordWidth := stringWidth(word)
+		if lineWidth > 0 && lineWidth+1+wordWidth > width {
+			flush()
+		}
+		if lineWidth > 0 {
+			line.WriteByte(' ')
+			lineWidth++
+		}
+		for _, r := range word {
+			rw := runewidth.RuneWidth(r)
+			if lineWidth > 0 && lineWidth+rw > width {
+				flush()
+			}
+			line.WriteRune(r)
+			lineWidth += rw
+		}
+	}
+	if lineWidth > 0 || len(lines) == 0 {
+		flush()
+	}
+	return lines
+}
+
+// wrapCell is wrapText for the text of a cell, keeping its indentation on
+// every line.
+func wrapCell(text string, width int) []string {
+	trimmed := strings.TrimLeft(text, " ")
+	indent := len(text) - len(trimmed)
+	if indent == 0 || indent >= width {
+		return wrapText(text, width)
+	}
+	lines := wrapText(trimmed, width-indent)
+	for i := range lines {
+		lines[i] = text[:indent] + lines[i]
+	}
+	return lines
+}
+
 func expandTabs(s string, tabWidth int) string {
 	var buf strings.Builder
 	col := 0
@@ -33,3 +121,11 @@ func expandTabs(s string, tabWidth int) string {
 	}
 	return buf.String()
 }
+
+// indentWithTabs replaces the leading spaces of s with as many tabs as fit,
+// followed by the remaining spaces.
+func indentWithTabs(s string, tabWidth int) string {
+	body := strings.TrimLeft(s, " ")
+	n := len(s) - len(body)
+	return strings.Repeat("\t", n/tabWidth) + strings.Repeat(" ", n%tabWidth) + body
+}
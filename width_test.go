@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -70,3 +71,23 @@ func TestExpandTabs(t *testing.T) {
 		}
 	}
 }
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		input string
+		width int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"one two three", 7, []string{"one two", "three"}},
+		{"abcdefgh", 3, []string{"abc", "def", "gh"}},
+		{"日本語テキスト", 6, []string{"日本語", "テキス", "ト"}},
+		{"a  b", 0, []string{"a  b"}},
+	}
+	for _, tt := range tests {
+		got := wrapText(tt.input, tt.width)
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("wrapText(%q, %d) = %q, want %q", tt.input, tt.width, got, tt.want)
+		}
+	}
+}